@@ -0,0 +1,212 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"runtime"
+	"sync"
+)
+
+type BatchOptions struct {
+	Workers  int     // max concurrent files, default is runtime.NumCPU()
+	MaxBytes int     // max decoded bytes in flight, 0 means no limit
+	Loader   Loader  // nil means Load
+	Encoder  Encoder // nil means Save picks the format from the file extension
+
+	// Configer estimates the decoded size for MaxBytes, nil means LoadConfig.
+	// A file without a config is loaded alone, as if it used all MaxBytes.
+	Configer LoadConfiger
+}
+
+type ConvertJob struct {
+	Src string
+	Dst string
+}
+
+// LoadImageBatch loads the files concurrently and calls fn for each image.
+// fn may be called from several goroutines, the image is released once fn
+// returns. The returned errors have the same index as filenames.
+func LoadImageBatch(filenames []string, opt *BatchOptions, fn func(i int, m *MemPImage, format string) error) []error {
+	if fn == nil {
+		return batchErrors(len(filenames), errors.New("image: LoadImageBatch, nil fn"))
+	}
+	var loader Loader
+	var configer LoadConfiger
+	if opt != nil {
+		loader, configer = opt.Loader, opt.Configer
+	}
+	return runBatch(len(filenames), opt, func(i int, limiter *byteLimiter) error {
+		n := limiter.Reserve(filenames[i], configer)
+		limiter.Acquire(n)
+		defer func() { limiter.Release(n) }()
+
+		m, format, err := LoadImageEx(filenames[i], loader)
+		if err != nil {
+			return err
+		}
+		n = limiter.Resize(n, SizeofImage(m))
+		return fn(i, m, format)
+	})
+}
+
+// ConvertBatch loads each job's Src and saves it as Dst concurrently.
+// The returned errors have the same index as jobs.
+func ConvertBatch(jobs []ConvertJob, opt *BatchOptions) []error {
+	var loader Loader
+	var encoder Encoder
+	var configer LoadConfiger
+	if opt != nil {
+		loader, encoder, configer = opt.Loader, opt.Encoder, opt.Configer
+	}
+	return runBatch(len(jobs), opt, func(i int, limiter *byteLimiter) error {
+		n := limiter.Reserve(jobs[i].Src, configer)
+		limiter.Acquire(n)
+		defer func() { limiter.Release(n) }()
+
+		m, _, err := LoadEx(jobs[i].Src, loader)
+		if err != nil {
+			return err
+		}
+		n = limiter.Resize(n, SizeofImage(m))
+		return Save(jobs[i].Dst, m, encoder)
+	})
+}
+
+// SaveBatch saves the images concurrently.
+// The returned errors have the same index as filenames.
+func SaveBatch(filenames []string, images []image.Image, opt *BatchOptions) []error {
+	if len(images) != len(filenames) {
+		return batchErrors(len(filenames), fmt.Errorf(
+			"image: SaveBatch, %d images for %d filenames", len(images), len(filenames),
+		))
+	}
+	var encoder Encoder
+	if opt != nil {
+		encoder = opt.Encoder
+	}
+	return runBatch(len(filenames), opt, func(i int, limiter *byteLimiter) error {
+		return Save(filenames[i], images[i], encoder)
+	})
+}
+
+func runBatch(n int, opt *BatchOptions, fn func(i int, limiter *byteLimiter) error) []error {
+	workers, maxBytes := runtime.NumCPU(), 0
+	if opt != nil {
+		if opt.Workers > 0 {
+			workers = opt.Workers
+		}
+		maxBytes = opt.MaxBytes
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var (
+		errs    = make([]error, n)
+		limiter = newByteLimiter(maxBytes)
+		jobs    = make(chan int)
+		wg      sync.WaitGroup
+	)
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = fn(i, limiter)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return errs
+}
+
+// batchErrors returns err for each of the n files.
+func batchErrors(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// estimateImageBytes returns the decoded size from the file header.
+func estimateImageBytes(filename string, configer LoadConfiger) (n int, ok bool) {
+	cfg, _, err := LoadConfigEx(filename, configer)
+	if err != nil || cfg.ColorModel == nil {
+		return 0, false
+	}
+	return cfg.Width * cfg.Height * SizeofPixel(ChannelsOf(cfg.ColorModel), DataTypeOf(cfg.ColorModel)), true
+}
+
+// byteLimiter bounds the bytes in flight, but always admits one
+// request when nothing is in flight, so a big image can not block.
+type byteLimiter struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	max  int
+	used int
+}
+
+func newByteLimiter(max int) *byteLimiter {
+	p := &byteLimiter{max: max}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Reserve returns the bytes to acquire for the file, all the limit if its
+// decoded size can not be estimated.
+func (p *byteLimiter) Reserve(filename string, configer LoadConfiger) int {
+	if p.max <= 0 {
+		return 0
+	}
+	if n, ok := estimateImageBytes(filename, configer); ok {
+		return n
+	}
+	return p.max
+}
+
+func (p *byteLimiter) Acquire(n int) {
+	if p.max <= 0 {
+		return
+	}
+	p.mu.Lock()
+	for p.used > 0 && p.used+n > p.max {
+		p.cond.Wait()
+	}
+	p.used += n
+	p.mu.Unlock()
+}
+
+// Resize changes the n acquired bytes to the decoded size without
+// waiting, and returns it.
+func (p *byteLimiter) Resize(n, size int) int {
+	if p.max <= 0 || n == size {
+		return size
+	}
+	p.mu.Lock()
+	p.used += size - n
+	p.mu.Unlock()
+	if size < n {
+		p.cond.Broadcast()
+	}
+	return size
+}
+
+func (p *byteLimiter) Release(n int) {
+	if p.max <= 0 {
+		return
+	}
+	p.mu.Lock()
+	p.used -= n
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
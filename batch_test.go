@@ -0,0 +1,140 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	_ "image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadImageBatch(t *testing.T) {
+	filenames := []string{
+		"./testdata/lena.png",
+		"./testdata/missing.png",
+		"./testdata/lena.jpg",
+		"./testdata/lena.png",
+	}
+
+	var count int32
+	errs := LoadImageBatch(filenames, &BatchOptions{Workers: 2, MaxBytes: 1 << 20},
+		func(i int, m *MemPImage, format string) error {
+			atomic.AddInt32(&count, 1)
+			if b := m.Bounds(); b.Dx() != 512 || b.Dy() != 512 {
+				t.Errorf("%s: bad bounds: %v", filenames[i], b)
+			}
+			return nil
+		},
+	)
+
+	if len(errs) != len(filenames) {
+		t.Fatalf("len(errs) = %d", len(errs))
+	}
+	for i, err := range errs {
+		if (err != nil) != (i == 1) {
+			t.Fatalf("%s: unexpected err: %v", filenames[i], err)
+		}
+	}
+	if count != 3 {
+		t.Fatalf("count = %d", count)
+	}
+}
+
+func TestConvertBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jobs := []ConvertJob{
+		{Src: "./testdata/lena.png", Dst: filepath.Join(dir, "a.memp")},
+		{Src: "./testdata/lena.jpg", Dst: filepath.Join(dir, "b.png")},
+		{Src: "./testdata/lena.jpg", Dst: filepath.Join(dir, "c.unknown")},
+	}
+	errs := ConvertBatch(jobs, nil)
+	if errs[0] != nil || errs[1] != nil || errs[2] == nil {
+		t.Fatalf("unexpected errs: %v", errs)
+	}
+
+	if _, format, err := LoadConfig(jobs[0].Dst); err != nil || format != "memp" {
+		t.Fatalf("bad output: %v, %v", format, err)
+	}
+}
+
+func TestLoadImageBatch_maxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a format without a config decoder
+	var filenames []string
+	for i := 0; i < 6; i++ {
+		filenames = append(filenames, filepath.Join(dir, "a.custom"))
+	}
+	if err := ioutil.WriteFile(filenames[0], []byte("custom"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var active, maxActive, configs int32
+	loader := func(filename string) (image.Image, string, error) {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			v := atomic.LoadInt32(&maxActive)
+			if n <= v || atomic.CompareAndSwapInt32(&maxActive, v, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		return NewMemPImage(image.Rect(0, 0, 10, 10), 1, reflect.Uint8), "custom", nil
+	}
+	fn := func(i int, m *MemPImage, format string) error { return nil }
+
+	// the unknown size is loaded alone
+	errs := LoadImageBatch(filenames, &BatchOptions{Workers: 4, MaxBytes: 1000, Loader: loader}, fn)
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if maxActive != 1 {
+		t.Fatalf("bad max active: %d", maxActive)
+	}
+
+	// the size from the config
+	errs = LoadImageBatch(filenames, &BatchOptions{
+		Workers:  4,
+		MaxBytes: 1000,
+		Loader:   loader,
+		Configer: func(filename string) (image.Config, string, error) {
+			atomic.AddInt32(&configs, 1)
+			return image.Config{ColorModel: ColorModel(1, reflect.Uint8), Width: 10, Height: 10}, "custom", nil
+		},
+	}, fn)
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if configs != 6 {
+		t.Fatalf("bad configs: %d", configs)
+	}
+
+	if errs := LoadImageBatch(filenames, nil, nil); len(errs) != 6 || errs[5] == nil {
+		t.Fatalf("expect nil fn errors: %v", errs)
+	}
+	if errs := SaveBatch(filenames, make([]image.Image, 5), nil); len(errs) != 6 || errs[0] == nil {
+		t.Fatalf("expect length errors: %v", errs)
+	}
+}
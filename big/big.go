@@ -3,18 +3,31 @@
 // license that can be found in the LICENSE file.
 
 // Package big provides big pyramid image support.
+//
+// Read always returns pixels the caller owns, also for the "memp" driver
+// which maps the file into memory. A view of the mapping returned by Read
+// would have no end of life: Close unmaps it while the caller may still
+// use it, and a write to the view of a read only mapping faults. The
+// pixels of the mapping are returned without a copy by ViewImage.View,
+// whose release tells when the view is no longer used.
 package big
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"image"
 	"reflect"
+	"sync"
+
+	ximage "github.com/chai2010/image"
 )
 
 var (
 	ErrNoOverviews        = errors.New("image/big: no overviews!")
 	ErrNoOverviewsFeature = errors.New("image/big: no overviews feature!")
+	ErrOverviewIndex      = errors.New("image/big: overview index out of range!")
+	ErrNoVerifyFeature    = errors.New("image/big: no verify feature!")
 	ErrFormat             = image.ErrFormat
 )
 
@@ -42,81 +55,289 @@ type ImageWriter interface {
 }
 
 type _ImageReaderDriver struct {
+	Name string
 	Open func(filename string) (ImageReader, error)
 }
 
 type _ImageWriterDriver struct {
+	Name   string
 	Open   func(filename string) (ImageWriter, error)
-	Create func(format, filename string, width, height, channels int, dataType reflect.Kind) (ImageWriter, error)
+	Create func(format, filename string, width, height, channels int, dataType reflect.Kind, opt *CreateOptions) (ImageWriter, error)
+}
+
+// CreateOptions are the creation options of CreateImageWriterWithOptions,
+// a driver returns an error for the options it can not honour.
+type CreateOptions struct {
+	TileSize         image.Point      // zero means the driver default
+	Compression      string           // "" means "none", or "deflate", "lz4", see RegisterTileCodec
+	Predictor        string           // "" means "none", or "horizontal" for the compressed integer tiles
+	ByteOrder        binary.ByteOrder // nil means binary.LittleEndian
+	NoData           *float64         // nil means no nodata value
+	ReserveOverviews bool             // allocate the overviews space on creation
+}
+
+// NoDataImage is implemented by the images which have a nodata value.
+type NoDataImage interface {
+	NoData() (v float64, ok bool)
+}
+
+// ViewImage is implemented by the images which can return their pixels
+// without a copy, Read always returns a copy.
+type ViewImage interface {
+	// View returns the pixels of r, which must be inside the image. The
+	// view is valid until release is called, Close waits for the release.
+	// The view of an image opened by OpenImageReader must not be written.
+	View(r image.Rectangle) (m *ximage.MemPImage, release func(), err error)
 }
 
 var (
+	_ImageDriverMu         sync.RWMutex
 	_ImageReaderDriverList []_ImageReaderDriver
 	_ImageWriterDriverList []_ImageWriterDriver
 )
 
+// DriverError is the error of a driver which can not open the file.
+type DriverError struct {
+	Driver string
+	Err    error
+}
+
+// OpenError reports why each driver rejected the file.
+//
+// errors.Is(err, ErrFormat) is true for an OpenError.
+type OpenError struct {
+	Op       string // "open" or "create"
+	Filename string
+	Errors   []DriverError
+}
+
+func (e *OpenError) Error() string {
+	s := fmt.Sprintf("image/big: %s %s: ", e.Op, e.Filename)
+	if len(e.Errors) == 0 {
+		return s + "no driver"
+	}
+	for i, v := range e.Errors {
+		if i > 0 {
+			s += "; "
+		}
+		s += fmt.Sprintf("%s: %v", v.Driver, v.Err)
+	}
+	return s
+}
+
+func (e *OpenError) Is(target error) bool {
+	if target == ErrFormat {
+		return true
+	}
+	for _, v := range e.Errors {
+		if errors.Is(v.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// MultiImageReader returns a reader which stitches the readers, it is safe
+// for concurrent use, the calls of each sub-reader are serialized.
+// The overlapped readers are composed in the order of their rectangles.
 func MultiImageReader(readers map[image.Rectangle]ImageReader) ImageReader {
-	return newMultiImageReader(readers)
+	return newMultiImageReader(sortedLayers(readers), nil, nil)
+}
+
+func MultiImageReaderWithOptions(readers map[image.Rectangle]ImageReader, opt *MultiOptions) ImageReader {
+	return newMultiImageReader(sortedLayers(readers), opt, nil)
+}
+
+// MultiImageReaderFromLayers is like MultiImageReader, the layers are
+// composed in the given order.
+func MultiImageReaderFromLayers(layers []MultiLayer, opt *MultiOptions) ImageReader {
+	return newMultiImageReader(layers, opt, nil)
 }
 
 func MultiOverviewImageReader(readers []map[image.Rectangle]ImageReader) ImageReader {
-	return newMultiOverviewImageReader(readers)
+	return newMultiOverviewImageReader(mapsToLayers(readers), nil)
 }
 
-func OpenImageReader(filename string) (r ImageReader, err error) {
+func MultiOverviewImageReaderWithOptions(readers []map[image.Rectangle]ImageReader, opt *MultiOptions) ImageReader {
+	return newMultiOverviewImageReader(mapsToLayers(readers), opt)
+}
+
+// MultiOverviewImageReaderFromLayers is like MultiOverviewImageReader,
+// levels[i] is the layers of the overview i.
+func MultiOverviewImageReaderFromLayers(levels [][]MultiLayer, opt *MultiOptions) ImageReader {
+	return newMultiOverviewImageReader(levels, opt)
+}
+
+func mapsToLayers(readers []map[image.Rectangle]ImageReader) [][]MultiLayer {
+	levels := make([][]MultiLayer, len(readers))
+	for i := range readers {
+		levels[i] = sortedLayers(readers[i])
+	}
+	return levels
+}
+
+// ImageReaderDrivers returns the registered reader driver names in order.
+func ImageReaderDrivers() []string {
+	_ImageDriverMu.RLock()
+	defer _ImageDriverMu.RUnlock()
+
+	var names []string
 	for _, it := range _ImageReaderDriverList {
+		names = append(names, it.Name)
+	}
+	return names
+}
+
+// ImageWriterDrivers returns the registered writer driver names in order.
+func ImageWriterDrivers() []string {
+	_ImageDriverMu.RLock()
+	defer _ImageDriverMu.RUnlock()
+
+	var names []string
+	for _, it := range _ImageWriterDriverList {
+		names = append(names, it.Name)
+	}
+	return names
+}
+
+func imageReaderDrivers() []_ImageReaderDriver {
+	_ImageDriverMu.RLock()
+	defer _ImageDriverMu.RUnlock()
+	return _ImageReaderDriverList
+}
+
+func imageWriterDrivers() []_ImageWriterDriver {
+	_ImageDriverMu.RLock()
+	defer _ImageDriverMu.RUnlock()
+	return _ImageWriterDriverList
+}
+
+// OpenImageReader tries the drivers in the registered order,
+// if all fail, the error is an *OpenError.
+func OpenImageReader(filename string) (r ImageReader, err error) {
+	openErr := &OpenError{Op: "open", Filename: filename}
+	for _, it := range imageReaderDrivers() {
 		if r, err = it.Open(filename); err == nil {
 			return
 		}
+		openErr.Errors = append(openErr.Errors, DriverError{it.Name, err})
 	}
-	err = ErrFormat
-	return
+	return nil, openErr
 }
 
+func OpenImageReaderWith(driverName, filename string) (r ImageReader, err error) {
+	for _, it := range imageReaderDrivers() {
+		if it.Name == driverName {
+			return it.Open(filename)
+		}
+	}
+	return nil, fmt.Errorf("image/big: unknown reader driver %q", driverName)
+}
+
+// OpenImageWriter tries the drivers in the registered order,
+// if all fail, the error is an *OpenError.
 func OpenImageWriter(filename string) (r ImageWriter, err error) {
-	for _, it := range _ImageWriterDriverList {
+	openErr := &OpenError{Op: "open", Filename: filename}
+	for _, it := range imageWriterDrivers() {
 		if r, err = it.Open(filename); err == nil {
 			return
 		}
+		openErr.Errors = append(openErr.Errors, DriverError{it.Name, err})
 	}
-	err = ErrFormat
-	return
+	return nil, openErr
 }
 
+func OpenImageWriterWith(driverName, filename string) (r ImageWriter, err error) {
+	for _, it := range imageWriterDrivers() {
+		if it.Name == driverName {
+			return it.Open(filename)
+		}
+	}
+	return nil, fmt.Errorf("image/big: unknown writer driver %q", driverName)
+}
+
+// CreateImageWriter tries the drivers in the registered order,
+// if all fail, the error is an *OpenError.
 func CreateImageWriter(format, filename string, width, height, channels int, dataType reflect.Kind) (w ImageWriter, err error) {
-	for _, it := range _ImageWriterDriverList {
-		if w, err = it.Create(format, filename, width, height, channels, dataType); err == nil {
+	return CreateImageWriterWithOptions(format, filename, width, height, channels, dataType, nil)
+}
+
+// CreateImageWriterWithOptions is like CreateImageWriter, opt can be nil.
+func CreateImageWriterWithOptions(format, filename string, width, height, channels int, dataType reflect.Kind, opt *CreateOptions) (w ImageWriter, err error) {
+	openErr := &OpenError{Op: "create", Filename: filename}
+	for _, it := range imageWriterDrivers() {
+		if w, err = it.Create(format, filename, width, height, channels, dataType, opt); err == nil {
 			return
 		}
+		openErr.Errors = append(openErr.Errors, DriverError{it.Name, err})
 	}
-	err = ErrFormat
-	return
+	return nil, openErr
 }
 
+// RegisterImageReader registers a reader driver,
+// the driver with the same name is replaced.
 func RegisterImageReader(driverName string,
 	open func(filename string) (ImageReader, error),
 ) {
-	_ImageReaderDriverList = append(
-		_ImageReaderDriverList,
-		_ImageReaderDriver{
-			Open: open,
-		},
-	)
+	_ImageDriverMu.Lock()
+	defer _ImageDriverMu.Unlock()
+
+	driver := _ImageReaderDriver{
+		Name: driverName,
+		Open: open,
+	}
+	list := append([]_ImageReaderDriver(nil), _ImageReaderDriverList...)
+	for i := range list {
+		if list[i].Name == driverName {
+			list[i] = driver
+			_ImageReaderDriverList = list
+			return
+		}
+	}
+	_ImageReaderDriverList = append(list, driver)
 }
 
+// RegisterImageWriter registers a writer driver without CreateOptions support,
+// the driver with the same name is replaced.
 func RegisterImageWriter(driverName string,
 	open func(filename string) (ImageWriter, error),
 	create func(format, filename string, width, height, channels int, dataType reflect.Kind) (ImageWriter, error),
 ) {
-	_ImageWriterDriverList = append(
-		_ImageWriterDriverList,
-		_ImageWriterDriver{
-			Open:   open,
-			Create: create,
+	RegisterImageWriterWithOptions(driverName, open,
+		func(format, filename string, width, height, channels int, dataType reflect.Kind, opt *CreateOptions) (ImageWriter, error) {
+			if opt != nil && *opt != (CreateOptions{}) {
+				return nil, fmt.Errorf("image/big: %s driver does not support CreateOptions", driverName)
+			}
+			return create(format, filename, width, height, channels, dataType)
 		},
 	)
 }
 
+// RegisterImageWriterWithOptions registers a writer driver,
+// the driver with the same name is replaced.
+func RegisterImageWriterWithOptions(driverName string,
+	open func(filename string) (ImageWriter, error),
+	create func(format, filename string, width, height, channels int, dataType reflect.Kind, opt *CreateOptions) (ImageWriter, error),
+) {
+	_ImageDriverMu.Lock()
+	defer _ImageDriverMu.Unlock()
+
+	driver := _ImageWriterDriver{
+		Name:   driverName,
+		Open:   open,
+		Create: create,
+	}
+	list := append([]_ImageWriterDriver(nil), _ImageWriterDriverList...)
+	for i := range list {
+		if list[i].Name == driverName {
+			list[i] = driver
+			_ImageWriterDriverList = list
+			return
+		}
+	}
+	_ImageWriterDriverList = append(list, driver)
+}
+
 func assert(condition bool, a ...interface{}) {
 	if !condition {
 		if msg := fmt.Sprint(a...); msg != "" {
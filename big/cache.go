@@ -0,0 +1,289 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"image"
+	"sync"
+
+	ximage "github.com/chai2010/image"
+)
+
+const (
+	DefaultCacheBlockSize = 256
+	DefaultCacheMaxBytes  = 64 << 20
+)
+
+var (
+	_ CachedImageReader = (*_CacheImageReader)(nil)
+	_ GeoImage          = (*_CacheImageReader)(nil)
+	_ MetadataImage     = (*_CacheImageReader)(nil)
+	_ NoDataImage       = (*_CacheImageReader)(nil)
+	_ TiledImage        = (*_CacheImageReader)(nil)
+
+	_ OverviewsBuilderContext = (*_CacheImageReader)(nil)
+	_ Verifier                = (*_CacheImageReader)(nil)
+)
+
+// TiledImage is implemented by the images which are stored in tiles.
+type TiledImage interface {
+	TileSize() image.Point
+}
+
+type CacheOptions struct {
+	BlockSize image.Point // zero means the TileSize of the reader, or DefaultCacheBlockSize
+	MaxBytes  int         // zero means DefaultCacheMaxBytes
+}
+
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Blocks    int // blocks in the cache
+	Bytes     int // bytes in the cache
+}
+
+// CachedImageReader is an ImageReader which keeps the recently read blocks.
+type CachedImageReader interface {
+	ImageReader
+	Stats() CacheStats
+	Purge()
+}
+
+type _CacheKey struct {
+	Level    int
+	Col, Row int
+}
+
+type _CacheBlock struct {
+	key  _CacheKey
+	m    *ximage.MemPImage // read only
+	size int
+}
+
+type _CacheImageReader struct {
+	ImageReader
+	blockSize image.Point
+	maxBytes  int
+
+	mu     sync.Mutex
+	lru    *list.List // front is the most recently used *_CacheBlock
+	blocks map[_CacheKey]*list.Element
+	stats  CacheStats
+}
+
+// CacheImageReader returns a reader which reads r in fixed-size blocks and
+// keeps them in a LRU cache of opt.MaxBytes, it is safe for concurrent use
+// if r is.
+func CacheImageReader(r ImageReader, opt *CacheOptions) CachedImageReader {
+	p := &_CacheImageReader{
+		ImageReader: r,
+		blockSize:   image.Pt(DefaultCacheBlockSize, DefaultCacheBlockSize),
+		maxBytes:    DefaultCacheMaxBytes,
+		lru:         list.New(),
+		blocks:      make(map[_CacheKey]*list.Element),
+	}
+	if t, ok := r.(TiledImage); ok {
+		if sz := t.TileSize(); sz.X > 0 && sz.Y > 0 {
+			p.blockSize = sz
+		}
+	}
+	if opt != nil {
+		if opt.BlockSize.X > 0 && opt.BlockSize.Y > 0 {
+			p.blockSize = opt.BlockSize
+		}
+		if opt.MaxBytes > 0 {
+			p.maxBytes = opt.MaxBytes
+		}
+	}
+	return p
+}
+
+func (p *_CacheImageReader) Stats() CacheStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+func (p *_CacheImageReader) Purge() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lru.Init()
+	p.blocks = make(map[_CacheKey]*list.Element)
+	p.stats.Blocks, p.stats.Bytes = 0, 0
+}
+
+func (p *_CacheImageReader) Close() error {
+	p.Purge()
+	return p.ImageReader.Close()
+}
+
+func (p *_CacheImageReader) BuildOverviews() error {
+	defer p.Purge()
+	return p.ImageReader.BuildOverviews()
+}
+
+func (p *_CacheImageReader) BuildOverviewsIfNotExists() error {
+	defer p.Purge()
+	return p.ImageReader.BuildOverviewsIfNotExists()
+}
+
+func (p *_CacheImageReader) BuildOverviewsContext(ctx context.Context, progress ProgressFunc) error {
+	defer p.Purge()
+	return BuildOverviewsContext(ctx, p.ImageReader, progress)
+}
+
+func (p *_CacheImageReader) BuildOverviewsIfNotExistsContext(ctx context.Context, progress ProgressFunc) error {
+	defer p.Purge()
+	return BuildOverviewsIfNotExistsContext(ctx, p.ImageReader, progress)
+}
+
+func (p *_CacheImageReader) Verify(ctx context.Context, opt *VerifyOptions) (*VerifyReport, error) {
+	if opt != nil && opt.Repair {
+		defer p.Purge()
+	}
+	return Verify(ctx, p.ImageReader, opt)
+}
+
+func (p *_CacheImageReader) Read(r image.Rectangle) (m image.Image, err error) {
+	return p.ReadOverview(0, r)
+}
+
+func (p *_CacheImageReader) ReadOverview(idxOverview int, r image.Rectangle) (m image.Image, err error) {
+	if idxOverview < 0 {
+		return nil, errors.New("image/big: _CacheImageReader.ReadOverview, invalid idxOverview!")
+	}
+	if r.Empty() {
+		return nil, errors.New("image/big: _CacheImageReader.Read, empty rect!")
+	}
+
+	dst := ximage.NewMemPImage(image.Rect(0, 0, r.Dx(), r.Dy()), p.Channels(), p.DataType())
+	bw, bh := p.blockSize.X, p.blockSize.Y
+	for row := floorDiv(r.Min.Y, bh); row*bh < r.Max.Y; row++ {
+		for col := floorDiv(r.Min.X, bw); col*bw < r.Max.X; col++ {
+			b, err := p.getBlock(_CacheKey{Level: idxOverview, Col: col, Row: row})
+			if err != nil {
+				return nil, err
+			}
+			bb := image.Rect(col*bw, row*bh, col*bw+bw, row*bh+bh)
+			z := bb.Intersect(r)
+			n := z.Dx() * ximage.SizeofPixel(dst.XChannels, dst.XDataType)
+			for y := z.Min.Y; y < z.Max.Y; y++ {
+				copy(
+					dst.XPix[dst.PixOffset(z.Min.X-r.Min.X, y-r.Min.Y):][:n],
+					b.m.XPix[b.m.PixOffset(z.Min.X-bb.Min.X, y-bb.Min.Y):][:n],
+				)
+			}
+		}
+	}
+	return dst, nil
+}
+
+func (p *_CacheImageReader) getBlock(key _CacheKey) (*_CacheBlock, error) {
+	p.mu.Lock()
+	if e, ok := p.blocks[key]; ok {
+		p.lru.MoveToFront(e)
+		p.stats.Hits++
+		p.mu.Unlock()
+		return e.Value.(*_CacheBlock), nil
+	}
+	p.stats.Misses++
+	p.mu.Unlock()
+
+	// read without the lock, the same block may be read twice
+	b, err := p.readBlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.blocks[key]; ok {
+		p.lru.MoveToFront(e)
+		return e.Value.(*_CacheBlock), nil
+	}
+	if b.size > p.maxBytes {
+		return b, nil // never fits
+	}
+	for p.stats.Bytes+b.size > p.maxBytes {
+		e := p.lru.Back()
+		old := p.lru.Remove(e).(*_CacheBlock)
+		delete(p.blocks, old.key)
+		p.stats.Blocks--
+		p.stats.Bytes -= old.size
+		p.stats.Evictions++
+	}
+	p.blocks[key] = p.lru.PushFront(b)
+	p.stats.Blocks++
+	p.stats.Bytes += b.size
+	return b, nil
+}
+
+func (p *_CacheImageReader) readBlock(key _CacheKey) (*_CacheBlock, error) {
+	bw, bh := p.blockSize.X, p.blockSize.Y
+	bb := image.Rect(key.Col*bw, key.Row*bh, key.Col*bw+bw, key.Row*bh+bh)
+
+	// the overview size is driver defined, only the image is clipped
+	rr := bb
+	if key.Level == 0 {
+		rr = bb.Intersect(image.Rect(0, 0, p.Width(), p.Height()))
+	}
+
+	m := ximage.NewMemPImage(image.Rect(0, 0, bw, bh), p.Channels(), p.DataType())
+	if !rr.Empty() {
+		sub, err := p.ImageReader.ReadOverview(key.Level, rr)
+		if err != nil {
+			return nil, err
+		}
+		src, ok := ximage.AsMemPImage(sub)
+		if !ok {
+			src = ximage.NewMemPImageFrom(sub)
+		}
+		if src.XChannels != m.XChannels || src.XDataType != m.XDataType {
+			return nil, errors.New("image/big: _CacheImageReader.Read, pixel type mismatch!")
+		}
+		if sb := src.Bounds(); sb.Dx() < rr.Dx() || sb.Dy() < rr.Dy() {
+			return nil, errors.New("image/big: _CacheImageReader.Read, image too small!")
+		}
+
+		sp := src.Bounds().Min
+		n := rr.Dx() * ximage.SizeofPixel(m.XChannels, m.XDataType)
+		for y := 0; y < rr.Dy(); y++ {
+			copy(
+				m.XPix[m.PixOffset(rr.Min.X-bb.Min.X, rr.Min.Y-bb.Min.Y+y):][:n],
+				src.XPix[src.PixOffset(sp.X, sp.Y+y):][:n],
+			)
+		}
+	}
+	return &_CacheBlock{key: key, m: m, size: len(m.XPix)}, nil
+}
+
+func (p *_CacheImageReader) GeoReference() (g *GeoReference, ok bool) {
+	if x, _ := p.ImageReader.(GeoImage); x != nil {
+		return x.GeoReference()
+	}
+	return nil, false
+}
+
+func (p *_CacheImageReader) Metadata() (md *Metadata, ok bool) {
+	if x, _ := p.ImageReader.(MetadataImage); x != nil {
+		return x.Metadata()
+	}
+	return nil, false
+}
+
+func (p *_CacheImageReader) NoData() (v float64, ok bool) {
+	return noDataOf(p.ImageReader)
+}
+
+// TileSize returns the tile size of the reader, or zero if not tiled.
+func (p *_CacheImageReader) TileSize() image.Point {
+	return tileSizeOf(p.ImageReader)
+}
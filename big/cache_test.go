@@ -0,0 +1,118 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"image"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type tCountImageReader struct {
+	ImageReader
+	reads int64
+}
+
+func (p *tCountImageReader) ReadOverview(idxOverview int, r image.Rectangle) (image.Image, error) {
+	atomic.AddInt64(&p.reads, 1)
+	return p.ImageReader.ReadOverview(idxOverview, r)
+}
+
+func TestCacheImageReader(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	src := tNewPattern(image.Rect(0, 0, 100, 80), 3, reflect.Uint8)
+
+	nodata := 7.0
+	w, err := CreateImageWriterWithOptions("raw", filename, 100, 80, 3, reflect.Uint8, &CreateOptions{
+		TileSize: image.Pt(32, 32),
+		NoData:   &nodata,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	r0, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &tCountImageReader{ImageReader: r0}
+	blockBytes := 32 * 32 * 3
+	r := CacheImageReader(counter, &CacheOptions{BlockSize: image.Pt(32, 32), MaxBytes: 6 * blockBytes})
+	defer r.Close()
+
+	if r := CacheImageReader(r0, nil).(*_CacheImageReader); r.blockSize != image.Pt(32, 32) {
+		t.Fatalf("bad block size: %v", r.blockSize)
+	}
+
+	// the nodata and the tile size of the reader
+	rc := CacheImageReader(r0, nil)
+	if v, ok := rc.(NoDataImage).NoData(); !ok || v != nodata {
+		t.Fatalf("bad nodata: %v, %v", v, ok)
+	}
+	if sz := rc.(TiledImage).TileSize(); sz != image.Pt(32, 32) {
+		t.Fatalf("bad tile size: %v", sz)
+	}
+	if sz := CacheImageReader(NewMemImage(src), nil).(TiledImage).TileSize(); sz != (image.Point{}) {
+		t.Fatalf("bad tile size: %v", sz)
+	}
+
+	rect := image.Rect(10, 10, 60, 50) // 2x2 blocks
+	for i := 0; i < 3; i++ {
+		m, err := r.Read(rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, m, src, rect)
+	}
+	if s := r.Stats(); s.Misses != 4 || s.Hits != 8 || s.Blocks != 4 || s.Bytes != 4*blockBytes {
+		t.Fatalf("bad stats: %+v", s)
+	}
+	if n := atomic.LoadInt64(&counter.reads); n != 4 {
+		t.Fatalf("bad driver reads: %d", n)
+	}
+
+	// the edge blocks and the outside are zero filled
+	m, err := r.Read(image.Rect(0, 0, 128, 96))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, m.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(image.Rect(0, 0, 100, 80)), src, src.Bounds())
+	if s := r.Stats(); s.Blocks != 6 || s.Evictions != 6 {
+		t.Fatalf("bad stats: %+v", s)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rect := image.Rect(i*5, i*3, i*5+40, i*3+30)
+			m, err := r.Read(rect)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			tEqualRect(t, m, src, rect)
+		}(i)
+	}
+	wg.Wait()
+
+	r.Purge()
+	if s := r.Stats(); s.Blocks != 0 || s.Bytes != 0 {
+		t.Fatalf("bad stats: %+v", s)
+	}
+}
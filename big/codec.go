@@ -0,0 +1,282 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// TileCodec compresses the tiles of the raw driver, it must be safe for
+// concurrent use.
+type TileCodec interface {
+	// Encode returns the compressed src, src is not retained.
+	Encode(src []byte) ([]byte, error)
+	// Decode decompresses src into dst, len(dst) is the tile size.
+	Decode(dst, src []byte) error
+}
+
+type _TileCodecEntry struct {
+	Name  string
+	ID    uint8
+	Codec TileCodec
+}
+
+var tileCodecs struct {
+	sync.RWMutex
+	list []_TileCodecEntry
+}
+
+func init() {
+	RegisterTileCodec("deflate", 1, deflateCodec{})
+	RegisterTileCodec("lz4", 2, lz4Codec{})
+}
+
+// RegisterTileCodec registers the codec used by CreateOptions.Compression
+// name, id is stored in the file. The id 0 is "none".
+func RegisterTileCodec(name string, id uint8, codec TileCodec) {
+	name = strings.ToLower(name)
+
+	tileCodecs.Lock()
+	defer tileCodecs.Unlock()
+
+	if id == 0 || name == "" || name == "none" {
+		panic(fmt.Sprintf("image/big: RegisterTileCodec, invalid codec: %q, %d", name, id))
+	}
+	for _, v := range tileCodecs.list {
+		if v.Name == name || v.ID == id {
+			panic(fmt.Sprintf("image/big: RegisterTileCodec, duplicate codec: %q, %d", name, id))
+		}
+	}
+	tileCodecs.list = append(tileCodecs.list, _TileCodecEntry{name, id, codec})
+}
+
+func lookupTileCodec(name string) (id uint8, codec TileCodec, ok bool) {
+	name = strings.ToLower(name)
+	if name == "" || name == "none" {
+		return 0, nil, true
+	}
+
+	tileCodecs.RLock()
+	defer tileCodecs.RUnlock()
+
+	for _, v := range tileCodecs.list {
+		if v.Name == name {
+			return v.ID, v.Codec, true
+		}
+	}
+	return 0, nil, false
+}
+
+func lookupTileCodecByID(id uint8) (codec TileCodec, ok bool) {
+	if id == 0 {
+		return nil, true
+	}
+
+	tileCodecs.RLock()
+	defer tileCodecs.RUnlock()
+
+	for _, v := range tileCodecs.list {
+		if v.ID == id {
+			return v.Codec, true
+		}
+	}
+	return nil, false
+}
+
+// ----------------------------------------------------------------------------
+
+var deflateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+type deflateCodec struct{}
+
+func (deflateCodec) Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := deflateWriters.Get().(*flate.Writer)
+	defer deflateWriters.Put(w)
+
+	w.Reset(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (deflateCodec) Decode(dst, src []byte) error {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+
+	if _, err := io.ReadFull(r, dst); err != nil {
+		return fmt.Errorf("image/big: deflate, %v", err)
+	}
+	if n, _ := io.Copy(ioutil.Discard, r); n != 0 {
+		return errors.New("image/big: deflate, tile too big!")
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+// lz4Codec is the LZ4 block format, without the frame.
+type lz4Codec struct{}
+
+const (
+	_LZ4MinMatch  = 4
+	_LZ4MaxOffset = 65535
+	_LZ4HashLog   = 14
+	_LZ4LastLits  = 5  // the last bytes are literals
+	_LZ4MinEnd    = 12 // the last match starts before the end
+)
+
+func (lz4Codec) Encode(src []byte) ([]byte, error) {
+	dst := make([]byte, 0, len(src)+len(src)/255+16)
+	if len(src) < _LZ4MinEnd+1 {
+		return lz4AppendSequence(dst, src, 0, 0), nil
+	}
+
+	var table [1 << _LZ4HashLog]int32 // position+1 of the hash
+	load32 := func(i int) uint32 {
+		return uint32(src[i]) | uint32(src[i+1])<<8 | uint32(src[i+2])<<16 | uint32(src[i+3])<<24
+	}
+
+	anchor, limit := 0, len(src)-_LZ4MinEnd
+	for i := 0; i <= limit; {
+		seq := load32(i)
+		h := (seq * 2654435761) >> (32 - _LZ4HashLog)
+		ref := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if ref < 0 || i-ref > _LZ4MaxOffset || load32(ref) != seq {
+			i++
+			continue
+		}
+
+		n := _LZ4MinMatch
+		for i+n < len(src)-_LZ4LastLits && src[ref+n] == src[i+n] {
+			n++
+		}
+		dst = lz4AppendSequence(dst, src[anchor:i], i-ref, n)
+		i += n
+		anchor = i
+	}
+	return lz4AppendSequence(dst, src[anchor:], 0, 0), nil
+}
+
+// lz4AppendSequence appends the literals and the match, the last sequence
+// has no match.
+func lz4AppendSequence(dst, lits []byte, offset, matchLen int) []byte {
+	token := byte(0)
+	if n := len(lits); n >= 15 {
+		token = 15 << 4
+	} else {
+		token = byte(n) << 4
+	}
+	if matchLen > 0 {
+		if n := matchLen - _LZ4MinMatch; n >= 15 {
+			token |= 15
+		} else {
+			token |= byte(n)
+		}
+	}
+	dst = append(dst, token)
+	if n := len(lits); n >= 15 {
+		dst = lz4AppendLength(dst, n-15)
+	}
+	dst = append(dst, lits...)
+	if matchLen > 0 {
+		dst = append(dst, byte(offset), byte(offset>>8))
+		if n := matchLen - _LZ4MinMatch; n >= 15 {
+			dst = lz4AppendLength(dst, n-15)
+		}
+	}
+	return dst
+}
+
+func lz4AppendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+func (lz4Codec) Decode(dst, src []byte) error {
+	errCorrupt := errors.New("image/big: lz4, corrupt tile!")
+	readLength := func(si, n int) (int, int, error) {
+		for {
+			if si >= len(src) {
+				return 0, 0, errCorrupt
+			}
+			b := src[si]
+			si++
+			n += int(b)
+			if b != 255 {
+				return si, n, nil
+			}
+		}
+	}
+
+	di, si := 0, 0
+	for si < len(src) {
+		token := src[si]
+		si++
+
+		lits := int(token >> 4)
+		if lits == 15 {
+			var err error
+			if si, lits, err = readLength(si, lits); err != nil {
+				return err
+			}
+		}
+		if lits > len(src)-si || lits > len(dst)-di {
+			return errCorrupt
+		}
+		di += copy(dst[di:], src[si:si+lits])
+		si += lits
+		if si == len(src) {
+			break // the last sequence
+		}
+
+		if si+2 > len(src) {
+			return errCorrupt
+		}
+		offset := int(src[si]) | int(src[si+1])<<8
+		si += 2
+		if offset == 0 || offset > di {
+			return errCorrupt
+		}
+		n := int(token & 15)
+		if n == 15 {
+			var err error
+			if si, n, err = readLength(si, n); err != nil {
+				return err
+			}
+		}
+		n += _LZ4MinMatch
+		if n > len(dst)-di {
+			return errCorrupt
+		}
+		for k := 0; k < n; k++ {
+			dst[di+k] = dst[di-offset+k] // may overlap
+		}
+		di += n
+	}
+	if di != len(dst) {
+		return errCorrupt
+	}
+	return nil
+}
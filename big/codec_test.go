@@ -0,0 +1,191 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+)
+
+func TestTileCodec(t *testing.T) {
+	random := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(random)
+	runs := bytes.Repeat([]byte("abcabcabd"), 1000)
+
+	for _, name := range []string{"deflate", "lz4"} {
+		_, codec, ok := lookupTileCodec(name)
+		if !ok {
+			t.Fatalf("%s: not registered", name)
+		}
+		for i, src := range [][]byte{
+			{},
+			{1},
+			[]byte("0123456789abc"),
+			make([]byte, 70000),
+			random,
+			runs,
+			append(append([]byte(nil), runs[:300]...), random[:300]...),
+		} {
+			data, err := codec.Encode(src)
+			if err != nil {
+				t.Fatalf("%s %d: %v", name, i, err)
+			}
+			dst := make([]byte, len(src))
+			if err := codec.Decode(dst, data); err != nil {
+				t.Fatalf("%s %d: %v", name, i, err)
+			}
+			if !bytes.Equal(dst, src) {
+				t.Fatalf("%s %d: decoded mismatch", name, i)
+			}
+			if len(src) > 1000 && src[0] == 0 && len(data) > len(src)/100 {
+				t.Fatalf("%s %d: not compressed: %d", name, i, len(data))
+			}
+
+			// a wrong size or corrupt data is an error
+			if len(src) > 0 {
+				if err := codec.Decode(make([]byte, len(src)+1), data); err == nil {
+					t.Fatalf("%s %d: expect size error", name, i)
+				}
+				if err := codec.Decode(dst, data[:len(data)/2]); err == nil {
+					t.Fatalf("%s %d: expect corrupt error", name, i)
+				}
+			}
+		}
+	}
+}
+
+func TestRawImage_compression(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	// a smooth image
+	src := ximage.NewMemPImage(image.Rect(0, 0, 150, 70), 3, reflect.Uint16)
+	for y := 0; y < 70; y++ {
+		for x := 0; x < 150; x++ {
+			v := src.XPix[src.PixOffset(x, y):]
+			for c := 0; c < 3; c++ {
+				ximage.PixSlice(v).SetValue(c, reflect.Uint16, float64(1000*c+x*7+y*3))
+			}
+		}
+	}
+
+	plain := filepath.Join(dir, "plain.raw")
+	tWriteRaw(t, plain, src, &CreateOptions{TileSize: image.Pt(32, 16)})
+	r0, err := OpenImageReader(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r0.Close()
+	if err := r0.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+	fi0, _ := os.Stat(plain)
+
+	for _, opt := range []*CreateOptions{
+		{Compression: "deflate"},
+		{Compression: "LZ4"},
+		{Compression: "deflate", Predictor: "horizontal", ByteOrder: binary.BigEndian},
+		{Compression: "lz4", Predictor: "horizontal"},
+	} {
+		opt.TileSize = image.Pt(32, 16)
+		filename := filepath.Join(dir, opt.Compression+opt.Predictor+".raw")
+		tWriteRaw(t, filename, src, opt)
+
+		r, err := OpenImageReader(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := r.Read(image.Rect(10, 5, 160, 66))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, m, src, image.Rect(10, 5, 160, 66))
+
+		// the same overviews as the uncompressed image
+		if err := r.BuildOverviews(); err != nil {
+			t.Fatal(err)
+		}
+		a, err := r.ReadOverview(2, image.Rect(0, 0, 37, 17))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := r0.ReadOverview(2, image.Rect(0, 0, 37, 17))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, a, ximage.NewMemPImageFrom(b), image.Rect(0, 0, 37, 17))
+
+		// the metadata and the rewritten tiles are appended
+		if err := r.(GeoWriter).SetGeoReference(&GeoReference{EPSG: 4326}); err != nil {
+			t.Fatal(err)
+		}
+		sub := image.Rect(40, 20, 60, 30)
+		if err := r.(ImageWriter).Write(sub, src.SubImage(sub)); err != nil {
+			t.Fatal(err)
+		}
+		if rep, err := Verify(context.Background(), r, &VerifyOptions{Full: true}); err != nil || !rep.OK() {
+			t.Fatalf("%+v: bad verify: %v, %+v", opt, err, rep)
+		}
+		r.Close()
+
+		fi, _ := os.Stat(filename)
+		if fi.Size() > fi0.Size()/2 {
+			t.Fatalf("%+v: not compressed: %d, %d", opt, fi.Size(), fi0.Size())
+		}
+
+		r, err = OpenImageReader(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, ok := r.(GeoImage).GeoReference(); !ok || g.EPSG != 4326 {
+			t.Fatalf("%+v: bad geo: %v, %+v", opt, ok, g)
+		}
+		m, err = r.Read(src.Bounds())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, m, src, src.Bounds())
+		r.Close()
+	}
+
+	for _, opt := range []*CreateOptions{
+		{Predictor: "horizontal"},
+		{Compression: "lz4", Predictor: "vertical"},
+		{Compression: "deflate", ReserveOverviews: true},
+	} {
+		if _, err := CreateImageWriterWithOptions("raw", filepath.Join(dir, "x.raw"), 10, 10, 1, reflect.Uint8, opt); err == nil {
+			t.Fatalf("%+v: expect error", opt)
+		}
+	}
+	if _, err := CreateImageWriterWithOptions("raw", filepath.Join(dir, "x.raw"), 10, 10, 1, reflect.Float32, &CreateOptions{
+		Compression: "lz4",
+		Predictor:   "horizontal",
+	}); err == nil {
+		t.Fatal("expect float predictor error")
+	}
+}
+
+func tWriteRaw(t *testing.T, filename string, src *ximage.MemPImage, opt *CreateOptions) {
+	b := src.Bounds()
+	w, err := CreateImageWriterWithOptions("raw", filename, b.Dx(), b.Dy(), src.XChannels, src.XDataType, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(b, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
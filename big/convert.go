@@ -0,0 +1,248 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"reflect"
+
+	ximage "github.com/chai2010/image"
+)
+
+var (
+	_ ImageReader = (*_ConvertImageReader)(nil)
+	_ GeoImage    = (*_ConvertImageReader)(nil)
+	_ NoDataImage = (*_ConvertImageReader)(nil)
+
+	_ MetadataImage = (*_ConvertImageReader)(nil)
+)
+
+// ConvertPolicy tells how the values are mapped to the target DataType.
+type ConvertPolicy int
+
+const (
+	ConvertClamp   ConvertPolicy = iota // the values are clamped to an integer target range, kept for the floats
+	ConvertRescale                      // [Min, Max] is mapped to the target range
+)
+
+// ConvertOptions are the target pixel type of ConvertImageReader.
+//
+// The target range is the range of an integer DataType, or [0, 1] for the
+// floats. ConvertClamp clamps and rounds the values to an integer target,
+// the float targets get the values as is. The source range of
+// ConvertRescale is [Min, Max], or the range of the source DataType if
+// both are zero, the result is clamped to the target range.
+//
+// A 1-channel source is repeated to the target channels, but the 4th.
+// The missing channels are zero, and the missing 4th channel is the
+// target maximum (opaque alpha).
+type ConvertOptions struct {
+	Channels int          // 0 keeps the source channels
+	DataType reflect.Kind // reflect.Invalid keeps the source DataType
+	Policy   ConvertPolicy
+	Min, Max float64
+	NoData   *float64 // the target of the source nodata and NaN values
+}
+
+type _ConvertImageReader struct {
+	ImageReader
+	opt        ConvertOptions
+	srcNoData  *float64
+	chans      []int     // the source channel of the target channel, -1 if missing
+	fill       []float64 // the value of the missing channels
+	isInt      bool      // the target DataType is an integer
+	tmin, tmax float64   // the target range
+	scale, off float64   // the rescale of the source values
+}
+
+// ConvertImageReader returns a reader which converts the pixels of r to
+// the channels and DataType of opt on every read.
+func ConvertImageReader(r ImageReader, opt *ConvertOptions) (ImageReader, error) {
+	p := &_ConvertImageReader{ImageReader: r}
+	if opt != nil {
+		p.opt = *opt
+	}
+	if p.opt.Channels == 0 {
+		p.opt.Channels = r.Channels()
+	}
+	if p.opt.DataType == reflect.Invalid {
+		p.opt.DataType = r.DataType()
+	}
+	if p.opt.Channels < 0 || ximage.SizeofKind(p.opt.DataType) == 0 {
+		return nil, fmt.Errorf("image/big: ConvertImageReader, invalid pixel type: %d, %v",
+			p.opt.Channels, p.opt.DataType,
+		)
+	}
+	if x, _ := r.(NoDataImage); x != nil {
+		if v, ok := x.NoData(); ok {
+			p.srcNoData = &v
+		}
+	}
+
+	p.tmin, p.tmax = 0, 1
+	if lo, hi, ok := kindRange(p.opt.DataType); ok {
+		p.isInt, p.tmin, p.tmax = true, lo, hi
+	}
+
+	p.scale, p.off = 1, 0
+	switch p.opt.Policy {
+	case ConvertClamp:
+	case ConvertRescale:
+		lo, hi := p.opt.Min, p.opt.Max
+		if lo == 0 && hi == 0 {
+			var ok bool
+			if lo, hi, ok = kindRange(r.DataType()); !ok {
+				return nil, errors.New("image/big: ConvertImageReader, rescale of floats needs Min and Max!")
+			}
+		}
+		if !(lo < hi) {
+			return nil, fmt.Errorf("image/big: ConvertImageReader, invalid range: [%v, %v]", lo, hi)
+		}
+		p.scale = (p.tmax - p.tmin) / (hi - lo)
+		p.off = p.tmin - lo*p.scale
+	default:
+		return nil, fmt.Errorf("image/big: ConvertImageReader, invalid policy: %d", p.opt.Policy)
+	}
+
+	p.chans = make([]int, p.opt.Channels)
+	p.fill = make([]float64, p.opt.Channels)
+	for c := range p.chans {
+		switch {
+		case c < r.Channels():
+			p.chans[c] = c
+		case r.Channels() == 1 && c != 3:
+			p.chans[c] = 0
+		default:
+			p.chans[c] = -1
+			if c == 3 {
+				p.fill[c] = p.tmax
+			}
+		}
+	}
+	return p, nil
+}
+
+// kindRange returns the range of an integer kind.
+func kindRange(dataType reflect.Kind) (min, max float64, ok bool) {
+	switch dataType {
+	case reflect.Int8:
+		return math.MinInt8, math.MaxInt8, true
+	case reflect.Int16:
+		return math.MinInt16, math.MaxInt16, true
+	case reflect.Int32:
+		return math.MinInt32, math.MaxInt32, true
+	case reflect.Int64:
+		return math.MinInt64, math.MaxInt64, true
+	case reflect.Uint8:
+		return 0, math.MaxUint8, true
+	case reflect.Uint16:
+		return 0, math.MaxUint16, true
+	case reflect.Uint32:
+		return 0, math.MaxUint32, true
+	case reflect.Uint64:
+		return 0, math.MaxUint64, true
+	}
+	return 0, 0, false
+}
+
+func (p *_ConvertImageReader) Channels() int {
+	return p.opt.Channels
+}
+func (p *_ConvertImageReader) DataType() reflect.Kind {
+	return p.opt.DataType
+}
+
+func (p *_ConvertImageReader) Read(r image.Rectangle) (m image.Image, err error) {
+	if m, err = p.ImageReader.Read(r); err != nil {
+		return nil, err
+	}
+	return p.convert(m)
+}
+
+func (p *_ConvertImageReader) ReadOverview(idxOverview int, r image.Rectangle) (m image.Image, err error) {
+	if m, err = p.ImageReader.ReadOverview(idxOverview, r); err != nil {
+		return nil, err
+	}
+	return p.convert(m)
+}
+
+func (p *_ConvertImageReader) convert(m image.Image) (*ximage.MemPImage, error) {
+	src := asMemPImage(m)
+	if src.XChannels != p.ImageReader.Channels() || src.XDataType != p.ImageReader.DataType() {
+		return nil, errors.New("image/big: _ConvertImageReader.Read, pixel type mismatch!")
+	}
+
+	sb := src.Bounds()
+	dst := ximage.NewMemPImage(image.Rect(0, 0, sb.Dx(), sb.Dy()), p.opt.Channels, p.opt.DataType)
+	spix, dpix := ximage.PixSlice(src.XPix), ximage.PixSlice(dst.XPix)
+	ssize, dsize := ximage.SizeofKind(src.XDataType), ximage.SizeofKind(dst.XDataType)
+
+	for y := 0; y < sb.Dy(); y++ {
+		for x := 0; x < sb.Dx(); x++ {
+			si := src.PixOffset(sb.Min.X+x, sb.Min.Y+y) / ssize
+			di := dst.PixOffset(x, y) / dsize
+			for c, sc := range p.chans {
+				if sc < 0 {
+					dpix.SetValue(di+c, dst.XDataType, p.fill[c])
+					continue
+				}
+				v := spix.Value(si+sc, src.XDataType)
+				if math.IsNaN(v) || (p.srcNoData != nil && v == *p.srcNoData) {
+					if p.opt.NoData != nil {
+						dpix.SetValue(di+c, dst.XDataType, *p.opt.NoData)
+					}
+					continue
+				}
+				v = v*p.scale + p.off
+				if p.isInt || p.opt.Policy == ConvertRescale {
+					v = math.Max(p.tmin, math.Min(v, p.tmax))
+				}
+				if p.isInt {
+					v = math.Floor(v + 0.5)
+				}
+				dpix.SetValue(di+c, dst.XDataType, v)
+			}
+		}
+	}
+	return dst, nil
+}
+
+func (p *_ConvertImageReader) GeoReference() (g *GeoReference, ok bool) {
+	return geoReferenceOf(p.ImageReader)
+}
+
+// Metadata returns the metadata of the source, the bands follow the target
+// channels. The band Scale and Offset are dropped if the values are rescaled.
+func (p *_ConvertImageReader) Metadata() (md *Metadata, ok bool) {
+	if md, ok = metadataOf(p.ImageReader); !ok {
+		return nil, false
+	}
+	md = md.Clone()
+	if len(md.Bands) == 0 {
+		return md, true
+	}
+	bands := make([]BandInfo, len(p.chans))
+	for c, sc := range p.chans {
+		if sc >= 0 && sc < len(md.Bands) {
+			bands[c] = md.Bands[sc]
+		}
+		if p.opt.Policy == ConvertRescale {
+			bands[c].Scale, bands[c].Offset = 0, 0
+		}
+	}
+	md.Bands = bands
+	return md, true
+}
+
+// NoData returns the target of the source nodata values.
+func (p *_ConvertImageReader) NoData() (v float64, ok bool) {
+	if p.opt.NoData == nil {
+		return 0, false
+	}
+	return *p.opt.NoData, true
+}
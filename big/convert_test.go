@@ -0,0 +1,168 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+)
+
+type tNoDataImageReader struct {
+	ImageReader
+	nodata float64
+}
+
+func (p *tNoDataImageReader) NoData() (float64, bool) {
+	return p.nodata, true
+}
+
+func TestConvertImageReader_rescale(t *testing.T) {
+	// float32 elevation in [100, 500], -9999 is nodata
+	src := ximage.NewMemPImage(image.Rect(0, 0, 4, 1), 1, reflect.Float32)
+	copy(ximage.PixSlice(src.XPix).Float32s(), []float32{100, 300, 500, -9999})
+
+	nodata := 0.0
+	r, err := ConvertImageReader(&tNoDataImageReader{NewMemImage(src), -9999}, &ConvertOptions{
+		Channels: 4,
+		DataType: reflect.Uint8,
+		Policy:   ConvertRescale,
+		Min:      100,
+		Max:      500,
+		NoData:   &nodata,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Channels() != 4 || r.DataType() != reflect.Uint8 {
+		t.Fatalf("bad pixel type: %d, %v", r.Channels(), r.DataType())
+	}
+
+	m, err := r.Read(image.Rect(0, 0, 4, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := ximage.AsMemPImage(m)
+	want := []byte{
+		0, 0, 0, 255,
+		128, 128, 128, 255,
+		255, 255, 255, 255,
+		0, 0, 0, 255,
+	}
+	if !bytes.Equal(p.XPix, want) {
+		t.Fatalf("bad pixels: %v", p.XPix)
+	}
+	if v, ok := r.(NoDataImage).NoData(); !ok || v != 0 {
+		t.Fatalf("bad nodata: %v, %v", v, ok)
+	}
+
+	// the metadata of the source
+	mr := NewMemImage(src)
+	if err := mr.(MetadataWriter).SetMetadata(&Metadata{Bands: []BandInfo{{Description: "dem"}}}); err != nil {
+		t.Fatal(err)
+	}
+	cr, err := ConvertImageReader(mr, &ConvertOptions{Channels: 2, DataType: reflect.Float64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, ok := cr.(MetadataImage).Metadata()
+	if !ok || len(md.Bands) != 2 || md.Bands[0].Description != "dem" || md.Bands[1].Description != "dem" {
+		t.Fatalf("bad metadata: %+v, %v", md, ok)
+	}
+
+	if _, err := ConvertImageReader(NewMemImage(src), &ConvertOptions{
+		DataType: reflect.Uint8,
+		Policy:   ConvertRescale,
+	}); err == nil {
+		t.Fatal("expect range error")
+	}
+}
+
+func TestConvertImageReader_clamp(t *testing.T) {
+	src := ximage.NewMemPImage(image.Rect(0, 0, 3, 1), 2, reflect.Int16)
+	copy(ximage.PixSlice(src.XPix).Int16s(), []int16{-5, 7, 200, 255, 1000, 300})
+
+	r, err := ConvertImageReader(NewMemImage(src), &ConvertOptions{
+		Channels: 3,
+		DataType: reflect.Uint8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := r.Read(image.Rect(1, 0, 4, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := ximage.AsMemPImage(m)
+	want := []byte{
+		200, 255, 0,
+		255, 255, 0,
+		0, 0, 0, // outside the image
+	}
+	if !bytes.Equal(p.XPix, want) {
+		t.Fatalf("bad pixels: %v", p.XPix)
+	}
+
+	// the default rescale of the integer range
+	f, err := ConvertImageReader(NewMemImage(src), &ConvertOptions{
+		Channels: 1,
+		DataType: reflect.Float64,
+		Policy:   ConvertRescale,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = f.Read(image.Rect(0, 0, 3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ = ximage.AsMemPImage(m)
+	for i, v := range p.XPix.Float64s() {
+		want := (float64(src.XPix.Int16s()[i*2]) + 32768) / 65535
+		if math.Abs(v-want) > 1e-12 {
+			t.Fatalf("%d: %v != %v", i, v, want)
+		}
+	}
+
+	if _, err := ConvertImageReader(NewMemImage(src), &ConvertOptions{DataType: reflect.String}); err == nil {
+		t.Fatal("expect pixel type error")
+	}
+}
+
+func TestConvertImageReader_clampFloat(t *testing.T) {
+	src := ximage.NewMemPImage(image.Rect(0, 0, 3, 1), 1, reflect.Float64)
+	copy(ximage.PixSlice(src.XPix).Float64s(), []float64{-1.5, 0.25, 300.75})
+
+	// the float target gets the values as is
+	r, err := ConvertImageReader(NewMemImage(src), &ConvertOptions{DataType: reflect.Float32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := r.Read(image.Rect(0, 0, 3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := ximage.AsMemPImage(m)
+	if v := p.XPix.Float32s(); !reflect.DeepEqual(v, []float32{-1.5, 0.25, 300.75}) {
+		t.Fatalf("bad float pixels: %v", v)
+	}
+
+	// the integer target is clamped and rounded
+	r, err = ConvertImageReader(NewMemImage(src), &ConvertOptions{DataType: reflect.Uint8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err = r.Read(image.Rect(0, 0, 3, 1)); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = ximage.AsMemPImage(m)
+	if !bytes.Equal(p.XPix, []byte{0, 0, 255}) {
+		t.Fatalf("bad uint8 pixels: %v", p.XPix)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"image"
+	"math"
+)
+
+// GeoTransform is the affine transform from the pixel (x, y) to the
+// world (X, Y), in the GDAL order:
+//
+//	X = T[0] + x*T[1] + y*T[2]
+//	Y = T[3] + x*T[4] + y*T[5]
+type GeoTransform [6]float64
+
+// RasterType tells what the transform of the pixel (0, 0) is.
+type RasterType int
+
+const (
+	PixelIsArea  RasterType = iota // the top-left corner of the pixel
+	PixelIsPoint                   // the center of the pixel
+)
+
+type GeoReference struct {
+	Transform  GeoTransform `json:"transform"`
+	WKT        string       `json:"wkt,omitempty"`  // CRS in WKT
+	EPSG       int          `json:"epsg,omitempty"` // CRS as EPSG code, 0 if unknown
+	RasterType RasterType   `json:"rasterType,omitempty"`
+}
+
+// GeoImage is implemented by the images which are georeferenced.
+type GeoImage interface {
+	GeoReference() (g *GeoReference, ok bool)
+}
+
+// GeoWriter is implemented by the images which can store the georeference.
+type GeoWriter interface {
+	SetGeoReference(g *GeoReference) error
+}
+
+func (t GeoTransform) PixelToWorld(x, y float64) (wx, wy float64) {
+	wx = t[0] + x*t[1] + y*t[2]
+	wy = t[3] + x*t[4] + y*t[5]
+	return
+}
+
+// WorldToPixel returns the pixel of the world (wx, wy),
+// ok is false if the transform is not invertible.
+func (t GeoTransform) WorldToPixel(wx, wy float64) (x, y float64, ok bool) {
+	inv, ok := t.Invert()
+	if !ok {
+		return 0, 0, false
+	}
+	x, y = inv.PixelToWorld(wx, wy)
+	return x, y, true
+}
+
+// Invert returns the transform from the world to the pixel.
+func (t GeoTransform) Invert() (inv GeoTransform, ok bool) {
+	det := t[1]*t[5] - t[2]*t[4]
+	if det == 0 {
+		return GeoTransform{}, false
+	}
+	inv[1] = t[5] / det
+	inv[2] = -t[2] / det
+	inv[4] = -t[4] / det
+	inv[5] = t[1] / det
+	inv[0] = -(inv[1]*t[0] + inv[2]*t[3])
+	inv[3] = -(inv[4]*t[0] + inv[5]*t[3])
+	return inv, true
+}
+
+// Translate returns the transform of the sub image starting at the pixel pt.
+func (t GeoTransform) Translate(pt image.Point) GeoTransform {
+	return t.translate(float64(pt.X), float64(pt.Y))
+}
+
+func (t GeoTransform) translate(x, y float64) GeoTransform {
+	t[0], t[3] = t.PixelToWorld(x, y)
+	return t
+}
+
+// Scale returns the transform of the image resized by sx and sy,
+// the overview i is scaled by 1/(1<<i).
+func (t GeoTransform) Scale(sx, sy float64) GeoTransform {
+	t[1], t[4] = t[1]/sx, t[4]/sx
+	t[2], t[5] = t[2]/sy, t[5]/sy
+	return t
+}
+
+func (g *GeoReference) Clone() *GeoReference {
+	if g == nil {
+		return nil
+	}
+	q := *g
+	return &q
+}
+
+// AreaTransform returns the transform of the pixel corner.
+func (g *GeoReference) AreaTransform() GeoTransform {
+	if g.RasterType == PixelIsPoint {
+		return g.Transform.translate(-0.5, -0.5)
+	}
+	return g.Transform
+}
+
+// sameGeoReference reports whether g and q are the same CRS, and their
+// transforms differ less than 1e-6 pixel.
+func sameGeoReference(g, q *GeoReference) bool {
+	if g.WKT != q.WKT || g.EPSG != q.EPSG || g.RasterType != q.RasterType {
+		return false
+	}
+	eps := 0.0
+	for _, i := range []int{1, 2, 4, 5} {
+		if v := math.Abs(g.Transform[i]); v > eps {
+			eps = v
+		}
+	}
+	eps *= 1e-6
+	for i := range g.Transform {
+		if math.Abs(g.Transform[i]-q.Transform[i]) > eps {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"image"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGeoTransform(t *testing.T) {
+	tr := GeoTransform{440720, 60, 2, 3751320, 1, -60}
+
+	wx, wy := tr.PixelToWorld(10, 20)
+	if wx != 440720+600+40 || wy != 3751320+10-1200 {
+		t.Fatalf("bad world: %v, %v", wx, wy)
+	}
+	x, y, ok := tr.WorldToPixel(wx, wy)
+	if !ok || math.Abs(x-10) > 1e-9 || math.Abs(y-20) > 1e-9 {
+		t.Fatalf("bad pixel: %v, %v, %v", x, y, ok)
+	}
+	if _, _, ok := (GeoTransform{0, 1, 1, 0, 1, 1}).WorldToPixel(0, 0); ok {
+		t.Fatal("expect not invertible")
+	}
+
+	sub := tr.Translate(image.Pt(10, 20))
+	if x, y := sub.PixelToWorld(0, 0); x != wx || y != wy {
+		t.Fatalf("bad translate: %v, %v", x, y)
+	}
+	ov := tr.Scale(0.5, 0.5)
+	if x, y := ov.PixelToWorld(5, 10); x != wx || y != wy {
+		t.Fatalf("bad scale: %v, %v", x, y)
+	}
+
+	g := &GeoReference{Transform: GeoTransform{100, 1, 0, 200, 0, -1}, RasterType: PixelIsPoint}
+	if a := g.AreaTransform(); a != (GeoTransform{99.5, 1, 0, 200.5, 0, -1}) {
+		t.Fatalf("bad area transform: %v", a)
+	}
+}
+
+func TestRawImage_geoReference(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	geo := &GeoReference{
+		Transform: GeoTransform{1000, 0.5, 0, 2000, 0, -0.5},
+		EPSG:      32633,
+	}
+	readers := make(map[image.Rectangle]ImageReader)
+	for i, b := range []image.Rectangle{
+		image.Rect(0, 0, 40, 30),
+		image.Rect(40, 0, 80, 30),
+	} {
+		filename := filepath.Join(dir, []string{"a.raw", "b.raw"}[i])
+		w, err := CreateImageWriterWithOptions("raw", filename, b.Dx(), b.Dy(), 1, reflect.Uint8, &CreateOptions{
+			TileSize: image.Pt(16, 16),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := geo.Clone()
+		g.Transform = g.Transform.Translate(b.Min)
+		if err := w.(GeoWriter).SetGeoReference(g); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		r, err := OpenImageReader(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := r.(GeoImage).GeoReference(); !ok || *got != *g {
+			t.Fatalf("bad georeference: %+v, %v", got, ok)
+		}
+		if err := r.BuildOverviews(); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := r.(GeoImage).GeoReference(); !ok {
+			t.Fatal("georeference lost")
+		}
+		readers[b] = r
+	}
+
+	r := MultiImageReader(readers)
+	defer r.Close()
+
+	if got, ok := r.(GeoImage).GeoReference(); !ok || !sameGeoReference(got, geo) {
+		t.Fatalf("bad multi georeference: %+v, %v", got, ok)
+	}
+	if _, ok := CacheImageReader(r, nil).(GeoImage).GeoReference(); !ok {
+		t.Fatal("cache lost the georeference")
+	}
+
+	// the layers disagree
+	r1 := MultiImageReader(map[image.Rectangle]ImageReader{
+		image.Rect(0, 0, 40, 30):  readers[image.Rect(0, 0, 40, 30)],
+		image.Rect(50, 0, 90, 30): readers[image.Rect(40, 0, 80, 30)],
+	})
+	if _, ok := r1.(GeoImage).GeoReference(); ok {
+		t.Fatal("expect no georeference")
+	}
+}
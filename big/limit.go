@@ -0,0 +1,114 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"image"
+
+	ximage "github.com/chai2010/image"
+)
+
+var (
+	_ ImageReader   = (*_LimitImageReader)(nil)
+	_ GeoImage      = (*_LimitImageReader)(nil)
+	_ MetadataImage = (*_LimitImageReader)(nil)
+	_ NoDataImage   = (*_LimitImageReader)(nil)
+	_ TiledImage    = (*_LimitImageReader)(nil)
+
+	_ OverviewsBuilderContext = (*_LimitImageReader)(nil)
+	_ Verifier                = (*_LimitImageReader)(nil)
+)
+
+// _LimitImageReader checks every Read/ReadOverview rectangle against
+// the decode options before calling the driver.
+type _LimitImageReader struct {
+	ImageReader
+	opt ximage.DecodeOptions
+}
+
+// LimitImageReader returns a reader which rejects reads bigger than opt
+// with a *ximage.DecodeLimitError.
+func LimitImageReader(r ImageReader, opt *ximage.DecodeOptions) ImageReader {
+	if opt == nil {
+		return r
+	}
+	return &_LimitImageReader{
+		ImageReader: r,
+		opt:         *opt,
+	}
+}
+
+// OpenImageReaderWithOptions opens the image and applies opt to its
+// size and to every read.
+func OpenImageReaderWithOptions(filename string, opt *ximage.DecodeOptions) (r ImageReader, err error) {
+	if r, err = OpenImageReader(filename); err != nil {
+		return nil, err
+	}
+	if opt == nil {
+		return r, nil
+	}
+
+	// big images may exceed the pixels/bytes limits, only reads may not
+	dim := ximage.DecodeOptions{MaxWidth: opt.MaxWidth, MaxHeight: opt.MaxHeight}
+	if err = dim.CheckSize(r.Width(), r.Height(), r.Channels(), r.DataType()); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return LimitImageReader(r, opt), nil
+}
+
+func (p *_LimitImageReader) check(r image.Rectangle) error {
+	return p.opt.CheckSize(r.Dx(), r.Dy(), p.Channels(), p.DataType())
+}
+
+func (p *_LimitImageReader) Read(r image.Rectangle) (m image.Image, err error) {
+	if err = p.check(r); err != nil {
+		return nil, err
+	}
+	return p.ImageReader.Read(r)
+}
+
+func (p *_LimitImageReader) ReadOverview(idxOverview int, r image.Rectangle) (m image.Image, err error) {
+	if err = p.check(r); err != nil {
+		return nil, err
+	}
+	return p.ImageReader.ReadOverview(idxOverview, r)
+}
+
+func (p *_LimitImageReader) GeoReference() (g *GeoReference, ok bool) {
+	if x, _ := p.ImageReader.(GeoImage); x != nil {
+		return x.GeoReference()
+	}
+	return nil, false
+}
+
+func (p *_LimitImageReader) Metadata() (md *Metadata, ok bool) {
+	if x, _ := p.ImageReader.(MetadataImage); x != nil {
+		return x.Metadata()
+	}
+	return nil, false
+}
+
+func (p *_LimitImageReader) NoData() (v float64, ok bool) {
+	return noDataOf(p.ImageReader)
+}
+
+// TileSize returns the tile size of the reader, or zero if not tiled.
+func (p *_LimitImageReader) TileSize() image.Point {
+	return tileSizeOf(p.ImageReader)
+}
+
+func (p *_LimitImageReader) BuildOverviewsContext(ctx context.Context, progress ProgressFunc) error {
+	return BuildOverviewsContext(ctx, p.ImageReader, progress)
+}
+
+func (p *_LimitImageReader) BuildOverviewsIfNotExistsContext(ctx context.Context, progress ProgressFunc) error {
+	return BuildOverviewsIfNotExistsContext(ctx, p.ImageReader, progress)
+}
+
+func (p *_LimitImageReader) Verify(ctx context.Context, opt *VerifyOptions) (*VerifyReport, error) {
+	return Verify(ctx, p.ImageReader, opt)
+}
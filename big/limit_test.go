@@ -0,0 +1,117 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"image"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+)
+
+func TestOpenImageReaderWithOptions(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	src := tNewPattern(image.Rect(0, 0, 100, 60), 2, reflect.Uint8)
+	nodata := 3.0
+	w, err := CreateImageWriterWithOptions("raw", filename, 100, 60, 2, reflect.Uint8, &CreateOptions{
+		TileSize: image.Pt(16, 16),
+		NoData:   &nodata,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.(GeoWriter).SetGeoReference(&GeoReference{EPSG: 4326}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.(MetadataWriter).SetMetadata(&Metadata{Bands: make([]BandInfo, 2)}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// the image size is checked at open
+	for _, opt := range []*ximage.DecodeOptions{
+		{MaxWidth: 99},
+		{MaxHeight: 59},
+	} {
+		r, err := OpenImageReaderWithOptions(filename, opt)
+		if _, ok := err.(*ximage.DecodeLimitError); !ok {
+			if r != nil {
+				r.Close()
+			}
+			t.Fatalf("%+v: expect *DecodeLimitError, got %v", opt, err)
+		}
+	}
+
+	// only the reads are checked against the pixels and bytes
+	r, err := OpenImageReaderWithOptions(filename, &ximage.DecodeOptions{
+		MaxWidth:  100,
+		MaxPixels: 1000,
+		MaxBytes:  1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	m, err := r.Read(image.Rect(10, 10, 30, 35))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, m, src, image.Rect(10, 10, 30, 35))
+	if _, err := r.Read(image.Rect(0, 0, 40, 40)); err == nil {
+		t.Fatal("expect pixels error")
+	} else if e, ok := err.(*ximage.DecodeLimitError); !ok || e.Limit != "pixels" {
+		t.Fatalf("expect pixels *DecodeLimitError, got %v", err)
+	}
+	if _, err := r.Read(image.Rect(0, 0, 25, 25)); err == nil {
+		t.Fatal("expect bytes error")
+	} else if e, ok := err.(*ximage.DecodeLimitError); !ok || e.Limit != "bytes" {
+		t.Fatalf("expect bytes *DecodeLimitError, got %v", err)
+	}
+
+	// the wrapped reader methods
+	if err := r.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.HasOverviews() {
+		t.Fatal("expect overviews")
+	}
+	if _, err := r.ReadOverview(1, image.Rect(0, 0, 50, 30)); err == nil {
+		t.Fatal("expect overview error")
+	} else if _, ok := err.(*ximage.DecodeLimitError); !ok {
+		t.Fatalf("expect *DecodeLimitError, got %v", err)
+	}
+	if _, err := r.ReadOverview(1, image.Rect(0, 0, 20, 20)); err != nil {
+		t.Fatal(err)
+	}
+	if g, ok := r.(GeoImage).GeoReference(); !ok || g.EPSG != 4326 {
+		t.Fatalf("bad georeference: %+v, %v", g, ok)
+	}
+	if md, ok := r.(MetadataImage).Metadata(); !ok || len(md.Bands) != 2 {
+		t.Fatalf("bad metadata: %+v, %v", md, ok)
+	}
+	if v, ok := r.(NoDataImage).NoData(); !ok || v != nodata {
+		t.Fatalf("bad nodata: %v, %v", v, ok)
+	}
+	if sz := r.(TiledImage).TileSize(); sz != image.Pt(16, 16) {
+		t.Fatalf("bad tile size: %v", sz)
+	}
+	if rep, err := Verify(context.Background(), r, &VerifyOptions{Full: true}); err != nil || !rep.OK() || !rep.Overviews {
+		t.Fatalf("bad verify: %v, %+v", err, rep)
+	}
+
+	if LimitImageReader(r, nil) != r {
+		t.Fatal("expect the reader without limits")
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"reflect"
+	"sync"
+
+	ximage "github.com/chai2010/image"
+	xdraw "github.com/chai2010/image/draw"
+)
+
+// ImageReadWriter is an image which can be read and written.
+type ImageReadWriter interface {
+	ImageReader
+	Write(r image.Rectangle, m image.Image) error
+}
+
+var (
+	_ ImageReadWriter = (*_MemImage)(nil)
+
+	_ GeoImage                = (*_MemImage)(nil)
+	_ GeoWriter               = (*_MemImage)(nil)
+	_ MetadataImage           = (*_MemImage)(nil)
+	_ MetadataWriter          = (*_MemImage)(nil)
+	_ OverviewsBuilderContext = (*_MemImage)(nil)
+)
+
+// _MemImage keeps the image and its overviews in memory, level i+1 is
+// level i reduced by 2x, until the level fits in one RawDefaultTileSize
+// tile. So the levels are the ones of a raw image of the default options.
+type _MemImage struct {
+	mu        sync.RWMutex
+	levels    []*ximage.MemPImage // levels[0] is the image, the others are nil if not built
+	overviews int                 // number of built overview levels
+	closed    bool
+	geo       *GeoReference
+	md        *Metadata
+}
+
+// NewMemImage returns an in-memory image of m, a *ximage.MemPImage is
+// not copied, so Write changes m. The overviews are built by BuildOverviews.
+func NewMemImage(m image.Image) ImageReadWriter {
+	p, ok := ximage.AsMemPImage(m)
+	if !ok {
+		p = ximage.NewMemPImageFrom(m)
+	}
+	if p.Bounds().Min != (image.Point{}) {
+		// the same pixels at (0,0)
+		q := *p
+		q.XRect = q.XRect.Sub(q.XRect.Min)
+		p = &q
+	}
+	return newMemImage(p)
+}
+
+// CreateMemImage returns a zero in-memory image.
+func CreateMemImage(width, height, channels int, dataType reflect.Kind) (ImageReadWriter, error) {
+	if width <= 0 || height <= 0 || channels <= 0 || ximage.SizeofKind(dataType) == 0 {
+		return nil, fmt.Errorf("image/big: CreateMemImage, invalid image: %dx%d, %d, %v", width, height, channels, dataType)
+	}
+	return newMemImage(ximage.NewMemPImage(image.Rect(0, 0, width, height), channels, dataType)), nil
+}
+
+func newMemImage(m *ximage.MemPImage) *_MemImage {
+	p := &_MemImage{levels: []*ximage.MemPImage{m}}
+	for w, h := m.XRect.Dx(), m.XRect.Dy(); w > RawDefaultTileSize || h > RawDefaultTileSize; {
+		w, h = maxInt(w/2, 1), maxInt(h/2, 1)
+		p.levels = append(p.levels, nil)
+	}
+	return p
+}
+
+func (p *_MemImage) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *_MemImage) Width() int {
+	return p.levels[0].XRect.Dx()
+}
+func (p *_MemImage) Height() int {
+	return p.levels[0].XRect.Dy()
+}
+func (p *_MemImage) Channels() int {
+	return p.levels[0].XChannels
+}
+func (p *_MemImage) DataType() reflect.Kind {
+	return p.levels[0].XDataType
+}
+
+func (p *_MemImage) HasOverviews() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.overviews > 0
+}
+func (p *_MemImage) HasOverviewsFeature() bool {
+	return len(p.levels) > 1
+}
+
+func (p *_MemImage) BuildOverviews() error {
+	return p.BuildOverviewsContext(context.Background(), nil)
+}
+func (p *_MemImage) BuildOverviewsIfNotExists() error {
+	return p.BuildOverviewsIfNotExistsContext(context.Background(), nil)
+}
+
+func (p *_MemImage) BuildOverviewsContext(ctx context.Context, progress ProgressFunc) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.buildOverviews(ctx, progress)
+}
+
+func (p *_MemImage) BuildOverviewsIfNotExistsContext(ctx context.Context, progress ProgressFunc) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.overviews > 0 {
+		return nil
+	}
+	return p.buildOverviews(ctx, progress)
+}
+
+// buildOverviews builds a level as one tile, from the 2x rect of the
+// parent clamped to the parent like the raw driver.
+func (p *_MemImage) buildOverviews(ctx context.Context, progress ProgressFunc) error {
+	if p.closed {
+		return errors.New("image/big: _MemImage.BuildOverviews, closed!")
+	}
+	if len(p.levels) < 2 {
+		return ErrNoOverviewsFeature
+	}
+	p.overviews = 0
+
+	state := OverviewsProgress{Levels: len(p.levels) - 1, TotalTiles: len(p.levels) - 1}
+	for level := 1; level < len(p.levels); level++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		b := p.levels[level-1].XRect
+		w, h := maxInt(b.Dx()/2, 1), maxInt(b.Dy()/2, 1)
+		src := p.readRect(level-1, image.Rect(0, 0, w*2, h*2).Intersect(image.Rect(0, 0, b.Dx(), b.Dy())))
+		dst := ximage.NewMemPImage(image.Rect(0, 0, w, h), p.Channels(), p.DataType())
+		xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, src.Bounds())
+		p.levels[level] = dst
+
+		state.Level, state.Tiles = level, level
+		if progress != nil {
+			progress(state)
+		}
+	}
+	p.overviews = len(p.levels) - 1
+	return nil
+}
+
+func (p *_MemImage) Read(r image.Rectangle) (m image.Image, err error) {
+	return p.ReadOverview(0, r)
+}
+
+func (p *_MemImage) ReadOverview(idxOverview int, r image.Rectangle) (m image.Image, err error) {
+	if idxOverview < 0 {
+		return nil, errors.New("image/big: _MemImage.ReadOverview, invalid idxOverview!")
+	}
+	if idxOverview >= len(p.levels) {
+		if len(p.levels) == 1 {
+			return nil, ErrNoOverviewsFeature
+		}
+		return nil, ErrOverviewIndex
+	}
+	if r.Empty() {
+		return nil, errors.New("image/big: _MemImage.Read, empty rect!")
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return nil, errors.New("image/big: _MemImage.Read, closed!")
+	}
+	if idxOverview > p.overviews {
+		return nil, ErrNoOverviews
+	}
+	return p.readRect(idxOverview, r), nil
+}
+
+// readRect returns a copy of r of the level, the pixels outside the
+// level are zero.
+func (p *_MemImage) readRect(level int, r image.Rectangle) *ximage.MemPImage {
+	src := p.levels[level]
+	dst := ximage.NewMemPImage(image.Rect(0, 0, r.Dx(), r.Dy()), src.XChannels, src.XDataType)
+	if z := r.Intersect(src.XRect); !z.Empty() {
+		n := z.Dx() * ximage.SizeofPixel(src.XChannels, src.XDataType)
+		for y := z.Min.Y; y < z.Max.Y; y++ {
+			copy(
+				dst.XPix[dst.PixOffset(z.Min.X-r.Min.X, y-r.Min.Y):][:n],
+				src.XPix[src.PixOffset(z.Min.X, y):][:n],
+			)
+		}
+	}
+	return dst
+}
+
+// Write writes m to r of the image, the overviews are out of date.
+func (p *_MemImage) Write(r image.Rectangle, m image.Image) error {
+	src, ok := ximage.AsMemPImage(m)
+	if !ok {
+		src = ximage.NewMemPImageFrom(m)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	dst := p.levels[0]
+	if p.closed {
+		return errors.New("image/big: _MemImage.Write, closed!")
+	}
+	if src.XChannels != dst.XChannels || src.XDataType != dst.XDataType {
+		return fmt.Errorf("image/big: _MemImage.Write, pixel type mismatch: (%d, %v) != (%d, %v)",
+			src.XChannels, src.XDataType, dst.XChannels, dst.XDataType,
+		)
+	}
+	if r.Empty() || !r.In(dst.XRect) {
+		return fmt.Errorf("image/big: _MemImage.Write, invalid rect: %v", r)
+	}
+	if sb := src.Bounds(); sb.Dx() < r.Dx() || sb.Dy() < r.Dy() {
+		return fmt.Errorf("image/big: _MemImage.Write, image too small: %v < %v", sb.Size(), r.Size())
+	}
+
+	p.overviews = 0
+	sp := src.Bounds().Min
+	n := r.Dx() * ximage.SizeofPixel(dst.XChannels, dst.XDataType)
+	for y := 0; y < r.Dy(); y++ {
+		copy(
+			dst.XPix[dst.PixOffset(r.Min.X, r.Min.Y+y):][:n],
+			src.XPix[src.PixOffset(sp.X, sp.Y+y):][:n],
+		)
+	}
+	return nil
+}
+
+func (p *_MemImage) GeoReference() (g *GeoReference, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.geo.Clone(), p.geo != nil
+}
+
+func (p *_MemImage) SetGeoReference(g *GeoReference) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.geo = g.Clone()
+	return nil
+}
+
+func (p *_MemImage) Metadata() (md *Metadata, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.md.Clone(), p.md != nil
+}
+
+func (p *_MemImage) SetMetadata(md *Metadata) error {
+	if md != nil && len(md.Bands) > p.Channels() {
+		return fmt.Errorf("image/big: _MemImage.SetMetadata, too many bands: %d > %d", len(md.Bands), p.Channels())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.md = md.Clone()
+	return nil
+}
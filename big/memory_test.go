@@ -0,0 +1,147 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"image"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+)
+
+func TestMemImage(t *testing.T) {
+	src := tNewPattern(image.Rect(0, 0, 50, 30), 3, reflect.Uint8)
+	m := tNewPattern(image.Rect(0, 0, 50, 30), 3, reflect.Uint8)
+	r := NewMemImage(m)
+
+	if r.Width() != 50 || r.Height() != 30 || r.Channels() != 3 || r.DataType() != reflect.Uint8 {
+		t.Fatalf("bad image: %dx%d, %d, %v", r.Width(), r.Height(), r.Channels(), r.DataType())
+	}
+	for _, rect := range []image.Rectangle{
+		image.Rect(0, 0, 50, 30),
+		image.Rect(7, 3, 21, 29),
+		image.Rect(40, 20, 60, 40),
+	} {
+		got, err := r.Read(rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, got, src, rect)
+	}
+
+	// 50x30 fits in one tile
+	if r.HasOverviewsFeature() {
+		t.Fatal("expect no overviews feature")
+	}
+	if _, err := r.ReadOverview(1, image.Rect(0, 0, 4, 4)); err != ErrNoOverviewsFeature {
+		t.Fatalf("expect ErrNoOverviewsFeature, got %v", err)
+	}
+
+	// the same levels and pixels as the raw driver
+	big := tNewPattern(image.Rect(0, 0, 600, 300), 3, reflect.Uint8)
+	br := NewMemImage(big)
+	if !br.HasOverviewsFeature() || br.HasOverviews() {
+		t.Fatal("bad overviews state")
+	}
+	if _, err := br.ReadOverview(1, image.Rect(0, 0, 4, 4)); err != ErrNoOverviews {
+		t.Fatalf("expect ErrNoOverviews, got %v", err)
+	}
+	if err := br.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+	w, err := CreateImageWriter("raw", filepath.Join(dir, "a.raw"), 600, 300, 3, reflect.Uint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write(big.Bounds(), big); err != nil {
+		t.Fatal(err)
+	}
+	raw := w.(ImageReader)
+	if err := raw.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 600x300, 300x150, 150x75
+	for level, rect := range []image.Rectangle{
+		image.Rect(0, 0, 600, 300),
+		image.Rect(0, 0, 300, 150),
+		image.Rect(0, 0, 150, 75),
+	} {
+		want, err := raw.ReadOverview(level, rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := br.ReadOverview(level, rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, got, want.(*ximage.MemPImage), rect)
+	}
+	for _, v := range []ImageReader{raw, br} {
+		if _, err := v.ReadOverview(3, image.Rect(0, 0, 1, 1)); err != ErrOverviewIndex {
+			t.Fatalf("expect ErrOverviewIndex, got %v", err)
+		}
+	}
+
+	// Write changes m, and the overviews are out of date
+	patch := tNewPattern(image.Rect(0, 0, 5, 5), 3, reflect.Uint8)
+	if err := r.Write(image.Rect(10, 10, 15, 15), patch); err != nil {
+		t.Fatal(err)
+	}
+	if r.HasOverviews() {
+		t.Fatal("expect no overviews")
+	}
+	if got := m.PixelAt(12, 13); !reflect.DeepEqual(got, patch.PixelAt(2, 3)) {
+		t.Fatalf("m not changed: %v", got)
+	}
+	if err := r.Write(image.Rect(45, 0, 55, 5), patch); err == nil {
+		t.Fatal("expect invalid rect error")
+	}
+
+	// a SubImage is not copied either
+	sub := m.SubImage(image.Rect(20, 10, 40, 30)).(*ximage.MemPImage)
+	rs := NewMemImage(sub)
+	if got, err := rs.Read(image.Rect(0, 0, 20, 20)); err != nil {
+		t.Fatal(err)
+	} else {
+		tEqualRect(t, got, m, image.Rect(20, 10, 40, 30))
+	}
+	if err := rs.Write(image.Rect(1, 2, 6, 7), patch); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.PixelAt(21+2, 12+3); !reflect.DeepEqual(got, patch.PixelAt(2, 3)) {
+		t.Fatalf("m not changed by the SubImage: %v", got)
+	}
+}
+
+func TestMemImage_overviewsEdge(t *testing.T) {
+	m := ximage.NewMemPImage(image.Rect(0, 0, 1, 600), 1, reflect.Uint8)
+	for i := range m.XPix {
+		m.XPix[i] = 200
+	}
+	r := NewMemImage(m)
+	if err := r.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1x600 => 1x300 => 1x150, the column outside is not averaged in
+	for level, h := 1, 300; level < 3; level, h = level+1, h/2 {
+		got, err := r.ReadOverview(level, image.Rect(0, 0, 1, h))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range got.(*ximage.MemPImage).XPix {
+			if v != 200 {
+				t.Fatalf("level %d: pix[%d]: %d != 200", level, i, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+// BandInfo describes a channel, the physical value of the pixel value v
+// is v*Scale + Offset, zero Scale means 1.
+type BandInfo struct {
+	Description string  `json:"description,omitempty"`
+	Unit        string  `json:"unit,omitempty"`
+	Scale       float64 `json:"scale,omitempty"`
+	Offset      float64 `json:"offset,omitempty"`
+}
+
+type Metadata struct {
+	Bands []BandInfo        `json:"bands,omitempty"` // Bands[i] is the channel i
+	Tags  map[string]string `json:"tags,omitempty"`
+}
+
+// MetadataImage is implemented by the images which have metadata.
+type MetadataImage interface {
+	Metadata() (md *Metadata, ok bool)
+}
+
+// MetadataWriter is implemented by the images which can store metadata.
+type MetadataWriter interface {
+	SetMetadata(md *Metadata) error
+}
+
+func (b BandInfo) Value(v float64) float64 {
+	if b.Scale == 0 {
+		return v + b.Offset
+	}
+	return v*b.Scale + b.Offset
+}
+
+func (md *Metadata) Clone() *Metadata {
+	if md == nil {
+		return nil
+	}
+	q := &Metadata{
+		Bands: append([]BandInfo(nil), md.Bands...),
+	}
+	if md.Tags != nil {
+		q.Tags = make(map[string]string, len(md.Tags))
+		for k, v := range md.Tags {
+			q.Tags[k] = v
+		}
+	}
+	return q
+}
+
+func (md *Metadata) Tag(key string) string {
+	if md == nil {
+		return ""
+	}
+	return md.Tags[key]
+}
+
+func (md *Metadata) SetTag(key, value string) {
+	if md.Tags == nil {
+		md.Tags = make(map[string]string)
+	}
+	md.Tags[key] = value
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"image"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRawImage_metadata(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	w, err := CreateImageWriter("raw", filename, 30, 20, 2, reflect.Uint16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := &Metadata{
+		Bands: []BandInfo{
+			{Description: "red", Unit: "W/m2/sr/um", Scale: 0.01, Offset: -0.1},
+			{Description: "nir"},
+		},
+	}
+	md.SetTag("SENSOR", "MSI")
+	if err := w.(MetadataWriter).SetMetadata(md); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.(GeoWriter).SetGeoReference(&GeoReference{EPSG: 4326}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.(MetadataWriter).SetMetadata(&Metadata{Bands: make([]BandInfo, 3)}); err == nil {
+		t.Fatal("expect too many bands error")
+	}
+	src := tNewPattern(image.Rect(0, 0, 30, 20), 2, reflect.Uint16)
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	got, ok := r.(MetadataImage).Metadata()
+	if !ok || !reflect.DeepEqual(got, md) {
+		t.Fatalf("bad metadata: %+v, %v", got, ok)
+	}
+	if got.Tag("SENSOR") != "MSI" || got.Bands[0].Value(100) != 0.9 || got.Bands[1].Value(7) != 7 {
+		t.Fatalf("bad metadata: %+v", got)
+	}
+	if g, ok := r.(GeoImage).GeoReference(); !ok || g.EPSG != 4326 {
+		t.Fatalf("bad georeference: %+v, %v", g, ok)
+	}
+	m, err := r.Read(src.Bounds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, m, src, src.Bounds())
+
+	// the copy is not shared
+	got.Tags["SENSOR"] = "x"
+	if md, _ := r.(MetadataImage).Metadata(); md.Tag("SENSOR") != "MSI" {
+		t.Fatal("metadata shared")
+	}
+	if md, ok := MultiImageReader(map[image.Rectangle]ImageReader{src.Bounds(): r}).(MetadataImage).Metadata(); !ok || md.Tag("SENSOR") != "MSI" {
+		t.Fatalf("multi lost the metadata: %+v, %v", md, ok)
+	}
+}
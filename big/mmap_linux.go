@@ -0,0 +1,317 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	ximage "github.com/chai2010/image"
+)
+
+// The "memp" driver maps the raw MemP files (see ximage.EncodeMemP) into
+// memory. Read returns a copy, since a view returned by Read could outlive
+// the mapping; View returns a view of the mapping with a release, which
+// sees the later writes. The readers map the file read only.
+const (
+	MMapDriverName = "memp"
+)
+
+var (
+	_ ImageReader = (*_MMapImage)(nil)
+	_ ImageWriter = (*_MMapImage)(nil)
+	_ ViewImage   = (*_MMapImage)(nil)
+)
+
+func init() {
+	if isLittleEndian {
+		RegisterImageReader(MMapDriverName, openMMapImageReader)
+		RegisterImageWriterWithOptions(MMapDriverName, openMMapImageWriter, createMMapImageWriter)
+	}
+}
+
+type _MMapImage struct {
+	mu       sync.RWMutex
+	data     []byte            // the mapping
+	m        *ximage.MemPImage // the image view of data
+	readOnly bool
+	views    sync.WaitGroup // the views not released
+}
+
+func openMMapImageReader(filename string) (ImageReader, error) {
+	return openMMapImage(filename, os.O_RDONLY, true)
+}
+
+func openMMapImageWriter(filename string) (ImageWriter, error) {
+	return openMMapImage(filename, os.O_RDWR, false)
+}
+
+func createMMapImageWriter(format, filename string, width, height, channels int, dataType reflect.Kind, opt *CreateOptions) (ImageWriter, error) {
+	if !strings.EqualFold(format, MMapDriverName) {
+		return nil, ErrFormat
+	}
+	if width <= 0 || height <= 0 || channels <= 0 || ximage.SizeofKind(dataType) == 0 {
+		return nil, fmt.Errorf("image/big: memp, invalid image: %dx%d, %d, %v", width, height, channels, dataType)
+	}
+	if opt != nil {
+		// the MemP file is untiled little endian pixels without overviews
+		switch {
+		case opt.TileSize != (image.Point{}):
+			return nil, errors.New("image/big: memp, tile size not supported")
+		case opt.Compression != "" && !strings.EqualFold(opt.Compression, "none"):
+			return nil, fmt.Errorf("image/big: memp, unsupported compression: %q", opt.Compression)
+		case opt.Predictor != "" && !strings.EqualFold(opt.Predictor, "none"):
+			return nil, fmt.Errorf("image/big: memp, unsupported predictor: %q", opt.Predictor)
+		case opt.ByteOrder != nil && opt.ByteOrder != binary.LittleEndian:
+			return nil, fmt.Errorf("image/big: memp, unsupported byte order: %v", opt.ByteOrder)
+		case opt.NoData != nil:
+			return nil, errors.New("image/big: memp, nodata not supported")
+		case opt.ReserveOverviews:
+			return nil, ErrNoOverviewsFeature
+		}
+	}
+
+	var hdr bytes.Buffer
+	if err := ximage.WriteMemPHeader(&hdr, width, height, channels, dataType); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if _, err = f.Write(hdr.Bytes()); err != nil {
+		return nil, err
+	}
+	size := int64(hdr.Len()) + int64(width)*int64(height)*int64(ximage.SizeofPixel(channels, dataType))
+	if err = f.Truncate(size); err != nil {
+		return nil, err
+	}
+	return newMMapImage(f, false)
+}
+
+func openMMapImage(filename string, flag int, readOnly bool) (*_MMapImage, error) {
+	f, err := os.OpenFile(filename, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // the mapping keeps the file
+
+	return newMMapImage(f, readOnly)
+}
+
+func newMMapImage(f *os.File, readOnly bool) (*_MMapImage, error) {
+	cfg, headerSize, err := ximage.ReadMemPHeader(io.NewSectionReader(f, 0, 1<<20))
+	if err != nil {
+		return nil, ErrFormat
+	}
+	channels := ximage.ChannelsOf(cfg.ColorModel)
+	dataType := ximage.DataTypeOf(cfg.ColorModel)
+	stride := cfg.Width * ximage.SizeofPixel(channels, dataType)
+
+	size := int64(headerSize) + int64(cfg.Height)*int64(stride)
+	if fi, err := f.Stat(); err != nil {
+		return nil, err
+	} else if fi.Size() < size {
+		return nil, fmt.Errorf("image/big: memp, truncated file: %d < %d", fi.Size(), size)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || size != int64(int(size)) {
+		return nil, fmt.Errorf("image/big: memp, can not map %dx%d image", cfg.Width, cfg.Height)
+	}
+
+	prot := syscall.PROT_READ | syscall.PROT_WRITE
+	if readOnly {
+		prot = syscall.PROT_READ
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), prot, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &_MMapImage{
+		data:     data,
+		readOnly: readOnly,
+		m: &ximage.MemPImage{
+			XMemPMagic: ximage.MemPMagic,
+			XRect:      image.Rect(0, 0, cfg.Width, cfg.Height),
+			XChannels:  channels,
+			XDataType:  dataType,
+			XPix:       data[headerSize:],
+			XStride:    stride,
+		},
+	}, nil
+}
+
+// Close unmaps the file, it waits for the running Read/Write and for the
+// release of the views.
+func (p *_MMapImage) Close() error {
+	p.mu.Lock()
+	if p.data == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	data := p.data
+	p.data, p.m = nil, nil
+	p.mu.Unlock()
+
+	p.views.Wait()
+	return syscall.Munmap(data)
+}
+
+func (p *_MMapImage) Width() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.m == nil {
+		return 0
+	}
+	return p.m.XRect.Dx()
+}
+func (p *_MMapImage) Height() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.m == nil {
+		return 0
+	}
+	return p.m.XRect.Dy()
+}
+func (p *_MMapImage) Channels() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.m == nil {
+		return 0
+	}
+	return p.m.XChannels
+}
+func (p *_MMapImage) DataType() reflect.Kind {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.m == nil {
+		return reflect.Invalid
+	}
+	return p.m.XDataType
+}
+
+func (p *_MMapImage) HasOverviews() bool {
+	return false
+}
+func (p *_MMapImage) HasOverviewsFeature() bool {
+	return false
+}
+func (p *_MMapImage) BuildOverviews() error {
+	return ErrNoOverviewsFeature
+}
+func (p *_MMapImage) BuildOverviewsIfNotExists() error {
+	return ErrNoOverviewsFeature
+}
+
+// View returns the pixels of r in the mapping, see ViewImage.
+func (p *_MMapImage) View(r image.Rectangle) (m *ximage.MemPImage, release func(), err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.m == nil {
+		return nil, nil, errors.New("image/big: _MMapImage.View, closed!")
+	}
+	if r.Empty() || !r.In(p.m.XRect) {
+		return nil, nil, fmt.Errorf("image/big: _MMapImage.View, invalid rect: %v", r)
+	}
+
+	p.views.Add(1)
+	var once sync.Once
+	release = func() { once.Do(p.views.Done) }
+	m = &ximage.MemPImage{
+		XMemPMagic: ximage.MemPMagic,
+		XRect:      image.Rect(0, 0, r.Dx(), r.Dy()),
+		XChannels:  p.m.XChannels,
+		XDataType:  p.m.XDataType,
+		XPix:       p.m.XPix[p.m.PixOffset(r.Min.X, r.Min.Y):],
+		XStride:    p.m.XStride,
+	}
+	return m, release, nil
+}
+
+// Read returns a copy of r, the pixels outside the image are zero.
+func (p *_MMapImage) Read(r image.Rectangle) (m image.Image, err error) {
+	if r.Empty() {
+		return nil, errors.New("image/big: _MMapImage.Read, empty rect!")
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.m == nil {
+		return nil, errors.New("image/big: _MMapImage.Read, closed!")
+	}
+
+	dst := ximage.NewMemPImage(image.Rect(0, 0, r.Dx(), r.Dy()), p.m.XChannels, p.m.XDataType)
+	if z := r.Intersect(p.m.XRect); !z.Empty() {
+		n := z.Dx() * ximage.SizeofPixel(p.m.XChannels, p.m.XDataType)
+		for y := z.Min.Y; y < z.Max.Y; y++ {
+			copy(
+				dst.XPix[dst.PixOffset(z.Min.X-r.Min.X, y-r.Min.Y):][:n],
+				p.m.XPix[p.m.PixOffset(z.Min.X, y):][:n],
+			)
+		}
+	}
+	return dst, nil
+}
+
+func (p *_MMapImage) ReadOverview(idxOverview int, r image.Rectangle) (m image.Image, err error) {
+	if idxOverview < 0 {
+		return nil, errors.New("image/big: _MMapImage.ReadOverview, invalid idxOverview!")
+	}
+	if idxOverview > 0 {
+		return nil, ErrNoOverviewsFeature
+	}
+	return p.Read(r)
+}
+
+func (p *_MMapImage) Write(r image.Rectangle, m image.Image) error {
+	src, ok := ximage.AsMemPImage(m)
+	if !ok {
+		src = ximage.NewMemPImageFrom(m)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.m == nil {
+		return errors.New("image/big: _MMapImage.Write, closed!")
+	}
+	if p.readOnly {
+		return errors.New("image/big: _MMapImage.Write, read only!")
+	}
+	if src.XChannels != p.m.XChannels || src.XDataType != p.m.XDataType {
+		return fmt.Errorf("image/big: _MMapImage.Write, pixel type mismatch: (%d, %v) != (%d, %v)",
+			src.XChannels, src.XDataType, p.m.XChannels, p.m.XDataType,
+		)
+	}
+	if r.Empty() || !r.In(p.m.XRect) {
+		return fmt.Errorf("image/big: _MMapImage.Write, invalid rect: %v", r)
+	}
+	if sb := src.Bounds(); sb.Dx() < r.Dx() || sb.Dy() < r.Dy() {
+		return fmt.Errorf("image/big: _MMapImage.Write, image too small: %v < %v", sb.Size(), r.Size())
+	}
+
+	sp := src.Bounds().Min
+	n := r.Dx() * ximage.SizeofPixel(p.m.XChannels, p.m.XDataType)
+	for y := 0; y < r.Dy(); y++ {
+		copy(
+			p.m.XPix[p.m.PixOffset(r.Min.X, r.Min.Y+y):][:n],
+			src.XPix[src.PixOffset(sp.X, sp.Y+y):][:n],
+		)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"image"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	ximage "github.com/chai2010/image"
+)
+
+func TestMMapImage(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.memp")
+	src := tNewPattern(image.Rect(0, 0, 300, 200), 2, reflect.Float32)
+
+	w, err := CreateImageWriter("memp", filename, 300, 200, 2, reflect.Float32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(image.Rect(0, 0, 300, 200), src); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a plain memp file
+	m, format, err := ximage.LoadImage(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "memp" {
+		t.Fatalf("format: %q", format)
+	}
+	tEqualRect(t, m, src, src.Bounds())
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.(*_MMapImage); !ok {
+		t.Fatalf("bad driver: %T", r)
+	}
+
+	for _, rect := range []image.Rectangle{
+		image.Rect(10, 20, 110, 120),
+		image.Rect(250, 150, 350, 250),
+	} {
+		m, err := r.Read(rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, ximage.NewMemPImageFrom(m).SubImage(image.Rect(0, 0, 50, 50)), src, image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+50, rect.Min.Y+50))
+	}
+
+	// Read returns a copy
+	m1, _ := r.Read(image.Rect(0, 0, 1, 1))
+	m1.(*ximage.MemPImage).XPix[0] ^= 0xFF
+	m1, _ = r.Read(image.Rect(0, 0, 1, 1))
+	tEqualRect(t, m1, src, image.Rect(0, 0, 1, 1))
+
+	if err := r.(ImageWriter).Write(image.Rect(0, 0, 1, 1), src); err == nil {
+		t.Fatal("expect read only error")
+	}
+
+	view, release, err := r.(ViewImage).View(image.Rect(10, 20, 110, 120))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, view, src, image.Rect(10, 20, 110, 120))
+	if _, _, err := r.(ViewImage).View(image.Rect(250, 150, 350, 250)); err == nil {
+		t.Fatal("expect rect error")
+	}
+
+	// Close waits for the view
+	closed := make(chan error)
+	go func() { closed <- r.Close() }()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-closed:
+		t.Fatal("closed before the release")
+	default:
+	}
+	tEqualRect(t, view, src, image.Rect(10, 20, 110, 120))
+	release()
+	release()
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Read(image.Rect(0, 0, 1, 1)); err == nil {
+		t.Fatal("expect closed error")
+	}
+	if _, _, err := r.(ViewImage).View(image.Rect(0, 0, 1, 1)); err == nil {
+		t.Fatal("expect closed error")
+	}
+
+	m, _, err = ximage.LoadImage(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, m, src, src.Bounds())
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"reflect"
+
+	ximage "github.com/chai2010/image"
+)
+
+const (
+	DefaultMosaicBlockSize = 1024
+)
+
+// MosaicEntry is an input file placed at Offset of the mosaic.
+type MosaicEntry struct {
+	Filename string
+	Offset   image.Point
+}
+
+type MosaicOptions struct {
+	Format      string         // output format, default is RawDriverName
+	Create      *CreateOptions // output options
+	Channels    int            // output pixel type, zero means the first entry's
+	DataType    reflect.Kind   // output pixel type, Invalid means the first entry's
+	BlockSize   int            // max block copied at once, default is DefaultMosaicBlockSize
+	NoOverviews bool           // do not build the overviews
+}
+
+type _MosaicEntry struct {
+	MosaicEntry
+	rect     image.Rectangle // in the mosaic
+	channels int
+	dataType reflect.Kind
+}
+
+// BuildMosaic writes the entries into a new big image, the later entry is
+// on top of the earlier. The mosaic size is the union of the entries, the
+// uncovered area is zero.
+//
+// The pixel types of the entries are checked before the output is created.
+// The entries are opened with OpenImageReader, or loaded with ximage.Load
+// one at a time, and are copied in blocks, so the mosaic is never in memory.
+func BuildMosaic(filename string, entries []MosaicEntry, opt *MosaicOptions) error {
+	if opt == nil {
+		opt = new(MosaicOptions)
+	}
+	if len(entries) == 0 {
+		return errors.New("image/big: BuildMosaic, no entry!")
+	}
+
+	list := make([]_MosaicEntry, len(entries))
+	var rect image.Rectangle
+	for i, v := range entries {
+		if v.Offset.X < 0 || v.Offset.Y < 0 {
+			return fmt.Errorf("image/big: BuildMosaic, %s: invalid offset: %v", v.Filename, v.Offset)
+		}
+		p, err := statMosaicEntry(v)
+		if err != nil {
+			return err
+		}
+		list[i] = p
+		rect = rect.Union(p.rect)
+	}
+
+	channels, dataType := opt.Channels, opt.DataType
+	if channels <= 0 || dataType == reflect.Invalid {
+		channels, dataType = list[0].channels, list[0].dataType
+	}
+	for _, v := range list {
+		if err := v.checkPixelType(channels, dataType); err != nil {
+			return err
+		}
+	}
+
+	format := opt.Format
+	if format == "" {
+		format = RawDriverName
+	}
+	w, err := CreateImageWriterWithOptions(format, filename, rect.Max.X, rect.Max.Y, channels, dataType, opt.Create)
+	if err != nil {
+		return err
+	}
+
+	blockSize := opt.BlockSize
+	if blockSize <= 0 {
+		blockSize = DefaultMosaicBlockSize
+	}
+	for _, v := range list {
+		if err = v.writeTo(w, blockSize); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	if opt.NoOverviews {
+		return nil
+	}
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err = r.BuildOverviews(); err != nil && err != ErrNoOverviewsFeature {
+		return err
+	}
+	return nil
+}
+
+// statMosaicEntry reads the entry size and pixel type. The file is closed.
+func statMosaicEntry(v MosaicEntry) (p _MosaicEntry, err error) {
+	p.MosaicEntry = v
+	if r, err := OpenImageReader(v.Filename); err == nil {
+		defer r.Close()
+		p.rect = image.Rect(0, 0, r.Width(), r.Height()).Add(v.Offset)
+		p.channels, p.dataType = r.Channels(), r.DataType()
+		return p, nil
+	}
+	cfg, _, err := ximage.LoadConfig(v.Filename)
+	if err != nil {
+		return p, err
+	}
+	p.rect = image.Rect(0, 0, cfg.Width, cfg.Height).Add(v.Offset)
+	p.channels, p.dataType = loadedPixelType(cfg.ColorModel)
+	return p, nil
+}
+
+// loadedPixelType returns the pixel type of the image loaded by
+// ximage.LoadImage, from the config color model.
+func loadedPixelType(m color.Model) (channels int, dataType reflect.Kind) {
+	if m, ok := m.(ximage.ColorModelInterface); ok {
+		return m.Channels(), m.DataType()
+	}
+	switch m {
+	case color.GrayModel:
+		return 1, reflect.Uint8
+	case color.Gray16Model:
+		return 1, reflect.Uint16
+	case color.RGBAModel, color.YCbCrModel:
+		return 4, reflect.Uint8
+	}
+	return 4, reflect.Uint16
+}
+
+func (p *_MosaicEntry) checkPixelType(channels int, dataType reflect.Kind) error {
+	if p.channels != channels || p.dataType != dataType {
+		return fmt.Errorf("image/big: BuildMosaic, %s: pixel type mismatch: (%d, %v) != (%d, %v)",
+			p.Filename, p.channels, p.dataType, channels, dataType,
+		)
+	}
+	return nil
+}
+
+// writeTo copies the entry in the blocks of the mosaic grid.
+func (p *_MosaicEntry) writeTo(w ImageWriter, blockSize int) error {
+	var read func(r image.Rectangle) (image.Image, error)
+
+	if r, err := OpenImageReader(p.Filename); err == nil {
+		defer r.Close()
+		read = r.Read
+	} else {
+		m, _, err := ximage.LoadImage(p.Filename)
+		if err != nil {
+			return err
+		}
+		if b := m.Bounds(); b.Size() != p.rect.Size() {
+			return fmt.Errorf("image/big: BuildMosaic, %s: size changed: %v != %v", p.Filename, b.Size(), p.rect.Size())
+		}
+		if m.XChannels != p.channels || m.XDataType != p.dataType {
+			return fmt.Errorf("image/big: BuildMosaic, %s: pixel type changed: (%d, %v) != (%d, %v)",
+				p.Filename, m.XChannels, m.XDataType, p.channels, p.dataType,
+			)
+		}
+		read = func(r image.Rectangle) (image.Image, error) {
+			return m.SubImage(r.Add(m.Bounds().Min)), nil
+		}
+	}
+
+	for y := p.rect.Min.Y / blockSize * blockSize; y < p.rect.Max.Y; y += blockSize {
+		for x := p.rect.Min.X / blockSize * blockSize; x < p.rect.Max.X; x += blockSize {
+			b := image.Rect(x, y, x+blockSize, y+blockSize).Intersect(p.rect)
+			m, err := read(b.Sub(p.rect.Min))
+			if err != nil {
+				return err
+			}
+			if err = w.Write(b, m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
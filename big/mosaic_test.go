@@ -0,0 +1,113 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+)
+
+func TestBuildMosaic(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	// a png at (0,0), a big image at (90,40) on top of it
+	a := tNewPattern(image.Rect(0, 0, 120, 70), 1, reflect.Uint8)
+	b := tNewPattern(image.Rect(0, 0, 100, 90), 1, reflect.Uint8)
+	for i := range b.XPix {
+		b.XPix[i] ^= 0x55
+	}
+
+	aName := filepath.Join(dir, "a.png")
+	if err := ximage.Save(aName, a.StdImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	bName := filepath.Join(dir, "b.raw")
+	w, err := CreateImageWriter("raw", bName, 100, 90, 1, reflect.Uint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(b.Bounds(), b); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	filename := filepath.Join(dir, "mosaic.raw")
+	err = BuildMosaic(filename, []MosaicEntry{
+		{aName, image.Pt(0, 0)},
+		{bName, image.Pt(90, 40)},
+	}, &MosaicOptions{
+		Create:    &CreateOptions{TileSize: image.Pt(32, 32)},
+		BlockSize: 64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.Width() != 190 || r.Height() != 130 || r.Channels() != 1 || r.DataType() != reflect.Uint8 {
+		t.Fatalf("bad image: %dx%d, %d, %v", r.Width(), r.Height(), r.Channels(), r.DataType())
+	}
+	if !r.HasOverviews() {
+		t.Fatal("expect overviews")
+	}
+
+	want := ximage.NewMemPImage(image.Rect(0, 0, 190, 130), 1, reflect.Uint8)
+	for y := 0; y < 70; y++ {
+		for x := 0; x < 120; x++ {
+			want.SetPixel(x, y, a.PixelAt(x, y))
+		}
+	}
+	for y := 0; y < 90; y++ {
+		for x := 0; x < 100; x++ {
+			want.SetPixel(90+x, 40+y, b.PixelAt(x, y))
+		}
+	}
+	m, err := r.Read(want.Bounds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, m, want, want.Bounds())
+
+	// pixel type mismatch
+	err = BuildMosaic(filename, []MosaicEntry{{aName, image.Pt(0, 0)}}, &MosaicOptions{
+		Channels: 3,
+		DataType: reflect.Uint8,
+	})
+	if err == nil {
+		t.Fatal("expect pixel type error")
+	}
+
+	// a later mismatch is found before the output is created
+	cName := filepath.Join(dir, "c.png")
+	c := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	c.Pix[3] = 0x80
+	if err := ximage.Save(cName, c, nil); err != nil {
+		t.Fatal(err)
+	}
+	filename = filepath.Join(dir, "mismatch.raw")
+	err = BuildMosaic(filename, []MosaicEntry{{aName, image.Pt(0, 0)}, {cName, image.Pt(0, 0)}}, nil)
+	if err == nil {
+		t.Fatal("expect pixel type error")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("expect no output: %v", err)
+	}
+
+	// the pixel type of the config is the loaded one
+	if err := BuildMosaic(filename, []MosaicEntry{{cName, image.Pt(0, 0)}}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
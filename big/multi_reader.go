@@ -5,9 +5,14 @@
 package big
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"image"
 	"reflect"
+	"runtime"
+	"sort"
+	"sync"
 
 	ximage "github.com/chai2010/image"
 	xdraw "github.com/chai2010/image/draw"
@@ -15,50 +20,224 @@ import (
 
 var (
 	_ ImageReader = (*_MultiImageReader)(nil)
+	_ GeoImage    = (*_MultiImageReader)(nil)
+
+	_ MetadataImage = (*_MultiImageReader)(nil)
+
+	_ OverviewsBuilderContext = (*_MultiImageReader)(nil)
 )
 
+// ComposeMode is how MultiImageReader resolves the overlapped layers.
+type ComposeMode int
+
+const (
+	ComposeLastWins   ComposeMode = iota // the later layer is on top
+	ComposeFirstWins                     // the earlier layer is on top
+	ComposeNoDataLast                    // like ComposeLastWins, but the nodata pixels are transparent
+)
+
+type MultiOptions struct {
+	Workers int         // max concurrent sub-reader reads, default is runtime.NumCPU()
+	Compose ComposeMode // default is ComposeLastWins
+	Fill    []float64   // pixel of the uncovered area, one value for all channels, nil means zero
+	NoData  *float64    // nodata of ComposeNoDataLast, nil means the layer's NoDataImage value
+}
+
+// MultiLayer is a sub-reader placed at Rect.Min, the reader must have
+// the Rect size. The reader must be of a comparable type, like a pointer,
+// the layers sharing a reader share its lock and close it once.
+type MultiLayer struct {
+	Rect   image.Rectangle
+	Reader ImageReader
+}
+
 type _MultiImageReader struct {
-	readers  map[image.Rectangle]ImageReader
+	mu       sync.RWMutex // Close vs the others
+	layers   []MultiLayer // in the z-order
+	locks    _ReaderLocks
+	workers  int
+	compose  ComposeMode
+	fill     []byte // fill pixel
+	nodata   *float64
+	geo      *GeoReference // nil if the layers do not agree
+	md       *Metadata     // nil if the layers do not agree
 	rect     image.Rectangle
 	channels int
 	dataType reflect.Kind
 }
 
-func newMultiImageReader(readers map[image.Rectangle]ImageReader) *_MultiImageReader {
-	if len(readers) == 0 {
+// _ReaderLocks serializes the calls of each sub-reader, the drivers
+// are not required to be safe for concurrent use. It is read only
+// after it is built.
+type _ReaderLocks map[ImageReader]*sync.Mutex
+
+func (p _ReaderLocks) add(r ImageReader) {
+	if _, ok := p[r]; !ok {
+		p[r] = new(sync.Mutex)
+	}
+}
+
+func (p _ReaderLocks) do(r ImageReader, fn func() error) error {
+	mu := p[r]
+	mu.Lock()
+	defer mu.Unlock()
+	return fn()
+}
+
+// sortedLayers returns the map as layers sorted by the rectangle,
+// so the overlapped layers are composed in a stable order.
+func sortedLayers(readers map[image.Rectangle]ImageReader) []MultiLayer {
+	layers := make([]MultiLayer, 0, len(readers))
+	for b, r := range readers {
+		layers = append(layers, MultiLayer{Rect: b, Reader: r})
+	}
+	sort.Slice(layers, func(i, j int) bool {
+		a, b := layers[i].Rect, layers[j].Rect
+		switch {
+		case a.Min.Y != b.Min.Y:
+			return a.Min.Y < b.Min.Y
+		case a.Min.X != b.Min.X:
+			return a.Min.X < b.Min.X
+		case a.Max.Y != b.Max.Y:
+			return a.Max.Y < b.Max.Y
+		default:
+			return a.Max.X < b.Max.X
+		}
+	})
+	return layers
+}
+
+func newMultiImageReader(layers []MultiLayer, opt *MultiOptions, locks _ReaderLocks) *_MultiImageReader {
+	if opt == nil {
+		opt = new(MultiOptions)
+	}
+	workers := runtime.NumCPU()
+	if opt.Workers > 0 {
+		workers = opt.Workers
+	}
+	if locks == nil {
+		locks = make(_ReaderLocks)
+	}
+	if len(layers) == 0 {
 		return &_MultiImageReader{}
 	}
 
 	p := &_MultiImageReader{
 		rect:    image.Rect(0, 0, 1, 1),
-		readers: make(map[image.Rectangle]ImageReader),
+		locks:   locks,
+		workers: workers,
+		compose: opt.Compose,
+		nodata:  opt.NoData,
 	}
-	for b, r := range readers {
-		if r == nil || b.Empty() || b.Min.X < 0 || b.Min.Y < 0 {
+	for _, v := range layers {
+		if v.Reader == nil || !isComparable(v.Reader) || v.Rect.Empty() || v.Rect.Min.X < 0 || v.Rect.Min.Y < 0 {
 			return &_MultiImageReader{}
 		}
-		if _, ok := p.readers[b]; ok {
-			continue // skip
-		}
 
-		p.readers[b] = r
-		p.rect = p.rect.Union(b)
-		p.channels = r.Channels()
-		p.dataType = r.DataType()
+		p.layers = append(p.layers, v)
+		p.locks.add(v.Reader)
+		p.rect = p.rect.Union(v.Rect)
+		p.channels = v.Reader.Channels()
+		p.dataType = v.Reader.DataType()
 	}
+	if len(opt.Fill) > 0 {
+		p.fill = make([]byte, ximage.SizeofPixel(p.channels, p.dataType))
+		for k := 0; k < p.channels; k++ {
+			v := opt.Fill[0]
+			if k < len(opt.Fill) {
+				v = opt.Fill[k]
+			}
+			ximage.PixSlice(p.fill).SetValue(k, p.dataType, v)
+		}
+		if isZero(p.fill) {
+			p.fill = nil
+		}
+	}
+	p.geo = layersGeoReference(p.layers)
+	p.md = layersMetadata(p.layers)
 	return p
 }
 
+// layersMetadata returns the metadata of the stitched image,
+// if all the layers have the same one.
+func layersMetadata(layers []MultiLayer) *Metadata {
+	var md *Metadata
+	for _, v := range layers {
+		x, _ := v.Reader.(MetadataImage)
+		if x == nil {
+			return nil
+		}
+		m, ok := x.Metadata()
+		if !ok {
+			return nil
+		}
+		if md == nil {
+			md = m
+		} else if !reflect.DeepEqual(md, m) {
+			return nil
+		}
+	}
+	return md
+}
+
+// layersGeoReference returns the georeference of the stitched image,
+// if all the layers have the same one.
+func layersGeoReference(layers []MultiLayer) *GeoReference {
+	var geo *GeoReference
+	for _, v := range layers {
+		x, _ := v.Reader.(GeoImage)
+		if x == nil {
+			return nil
+		}
+		g, ok := x.GeoReference()
+		if !ok {
+			return nil
+		}
+		g = g.Clone()
+		g.Transform = g.Transform.Translate(image.Point{}.Sub(v.Rect.Min))
+		if geo == nil {
+			geo = g
+		} else if !sameGeoReference(geo, g) {
+			return nil
+		}
+	}
+	return geo
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isComparable reports whether r can be a map key.
+func isComparable(r ImageReader) bool {
+	return reflect.TypeOf(r).Comparable()
+}
+
 func (p *_MultiImageReader) Close() error {
+	return p.close(make(map[ImageReader]bool))
+}
+
+// close closes the readers not in closed, and adds them to closed.
+func (p *_MultiImageReader) close(closed map[ImageReader]bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	var firstErr error
-	if len(p.readers) > 0 {
-		for _, r := range p.readers {
-			if err := r.Close(); err != nil && firstErr == nil {
-				firstErr = err
-			}
+	for _, v := range p.layers {
+		if closed[v.Reader] {
+			continue
+		}
+		closed[v.Reader] = true
+		if err := v.Reader.Close(); err != nil && firstErr == nil {
+			firstErr = err
 		}
-		p.readers = nil
 	}
+	p.layers = nil
 	return firstErr
 }
 
@@ -75,56 +254,95 @@ func (p *_MultiImageReader) DataType() reflect.Kind {
 	return p.dataType
 }
 
+func (p *_MultiImageReader) GeoReference() (g *GeoReference, ok bool) {
+	return p.geo.Clone(), p.geo != nil
+}
+
+func (p *_MultiImageReader) Metadata() (md *Metadata, ok bool) {
+	return p.md.Clone(), p.md != nil
+}
+
 func (p *_MultiImageReader) HasOverviews() bool {
-	if len(p.readers) == 0 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.layers) == 0 {
 		return false
 	}
-	if len(p.readers) > 1 {
+	if len(p.layers) > 1 {
 		return false
 	}
-	for _, r := range p.readers {
-		return r.HasOverviews()
-	}
-	return false
+	r := p.layers[0].Reader
+	var ok bool
+	p.locks.do(r, func() error {
+		ok = r.HasOverviews()
+		return nil
+	})
+	return ok
 }
 func (p *_MultiImageReader) HasOverviewsFeature() bool {
-	if len(p.readers) == 0 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.layers) == 0 {
 		return false
 	}
-	if len(p.readers) > 1 {
+	if len(p.layers) > 1 {
 		return false
 	}
-	for _, r := range p.readers {
-		return r.HasOverviewsFeature()
-	}
-	return false
+	r := p.layers[0].Reader
+	var ok bool
+	p.locks.do(r, func() error {
+		ok = r.HasOverviewsFeature()
+		return nil
+	})
+	return ok
 }
 func (p *_MultiImageReader) BuildOverviews() error {
-	if len(p.readers) == 0 {
+	return p.BuildOverviewsContext(context.Background(), nil)
+}
+func (p *_MultiImageReader) BuildOverviewsIfNotExists() error {
+	return p.BuildOverviewsIfNotExistsContext(context.Background(), nil)
+}
+func (p *_MultiImageReader) BuildOverviewsContext(ctx context.Context, progress ProgressFunc) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.layers) == 0 {
 		return errors.New("image/big: _MultiImageReader.BuildOverviews, no reader!")
 	}
-	if len(p.readers) > 1 {
+	if len(p.layers) > 1 {
 		return ErrNoOverviewsFeature
 	}
-	for _, r := range p.readers {
-		return r.BuildOverviews()
-	}
-	return ErrNoOverviewsFeature
+	r := p.layers[0].Reader
+	return p.locks.do(r, func() error {
+		return BuildOverviewsContext(ctx, r, progress)
+	})
 }
-func (p *_MultiImageReader) BuildOverviewsIfNotExists() error {
-	if len(p.readers) == 0 {
+func (p *_MultiImageReader) BuildOverviewsIfNotExistsContext(ctx context.Context, progress ProgressFunc) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.layers) == 0 {
 		return errors.New("image/big: _MultiImageReader.BuildOverviewsIfNotExists, no reader!")
 	}
-	if len(p.readers) > 1 {
+	if len(p.layers) > 1 {
 		return ErrNoOverviewsFeature
 	}
-	for _, r := range p.readers {
-		return r.BuildOverviewsIfNotExists()
-	}
-	return ErrNoOverviewsFeature
+	r := p.layers[0].Reader
+	return p.locks.do(r, func() error {
+		return BuildOverviewsIfNotExistsContext(ctx, r, progress)
+	})
 }
 func (p *_MultiImageReader) Read(rect image.Rectangle) (m image.Image, err error) {
-	if len(p.readers) == 0 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.read(rect)
+}
+
+func (p *_MultiImageReader) read(rect image.Rectangle) (m image.Image, err error) {
+	if len(p.layers) == 0 {
 		return nil, errors.New("image/big: _MultiImageReader.Read, no reader!")
 	}
 	if rect.Empty() {
@@ -132,45 +350,124 @@ func (p *_MultiImageReader) Read(rect image.Rectangle) (m image.Image, err error
 	}
 
 	// only on image, start at (0,0)
-	if len(p.readers) == 1 && p.rect.Min == image.Pt(0, 0) {
-		for _, r := range p.readers {
-			return r.Read(rect)
-		}
+	if len(p.layers) == 1 && p.rect.Min == image.Pt(0, 0) && p.fill == nil && p.compose != ComposeNoDataLast {
+		r := p.layers[0].Reader
+		err = p.locks.do(r, func() (err error) {
+			m, err = r.Read(rect)
+			return
+		})
+		return
 	}
 
-	// find readers rect
-	var rectList []image.Rectangle
-	for b, _ := range p.readers {
-		if !b.Intersect(rect).Empty() {
-			rectList = append(rectList, b)
+	// find the layers in the paint order, the bottom first
+	var layerList []MultiLayer
+	for _, v := range p.layers {
+		if !v.Rect.Intersect(rect).Empty() {
+			layerList = append(layerList, v)
 		}
 	}
-	if len(rectList) == 0 {
-		m = ximage.NewMemPImage(image.Rect(0, 0, rect.Dx(), rect.Dy()), p.channels, p.dataType)
-		return m, nil
+	if p.compose == ComposeFirstWins {
+		for i, j := 0, len(layerList)-1; i < j; i, j = i+1, j-1 {
+			layerList[i], layerList[j] = layerList[j], layerList[i]
+		}
 	}
 
-	// read rect form rectList
-	m = ximage.NewMemPImage(image.Rect(0, 0, rect.Dx(), rect.Dy()), p.channels, p.dataType)
-	for i := 0; i < len(rectList); i++ {
-		r := p.readers[rectList[i]]
-		b := rect.Intersect(rectList[i])
+	// read sub images in parallel
+	subList := make([]*ximage.MemPImage, len(layerList))
+	errList := make([]error, len(layerList))
+	sem := make(chan struct{}, p.workers)
+	var wg sync.WaitGroup
+	for i := 0; i < len(layerList); i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			v := layerList[i]
+			b := rect.Intersect(v.Rect)
+			errList[i] = p.locks.do(v.Reader, func() error {
+				sub, err := v.Reader.Read(b.Sub(v.Rect.Min))
+				if err != nil {
+					return err
+				}
+				var ok bool
+				if subList[i], ok = ximage.AsMemPImage(sub); !ok {
+					subList[i] = ximage.NewMemPImageFrom(sub)
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < len(layerList); i++ {
+		if errList[i] != nil {
+			return nil, errList[i]
+		}
+		if subList[i].XChannels != p.channels || subList[i].XDataType != p.dataType {
+			return nil, errors.New("image/big: _MultiImageReader.Read, pixel type mismatch!")
+		}
+	}
 
-		// read sub image
-		sub, err := r.Read(b.Sub(rectList[i].Min))
-		if err != nil {
-			return nil, err
+	// fill, then draw the layers from the bottom
+	dst := ximage.NewMemPImage(image.Rect(0, 0, rect.Dx(), rect.Dy()), p.channels, p.dataType)
+	if p.fill != nil {
+		for y := 0; y < rect.Dy(); y++ {
+			for x := 0; x < rect.Dx(); x++ {
+				copy(dst.XPix[dst.PixOffset(x, y):], p.fill)
+			}
+		}
+	}
+	for i := 0; i < len(layerList); i++ {
+		b := rect.Intersect(layerList[i].Rect)
+		sub, sp := subList[i], subList[i].Bounds().Min
+		nodata := p.nodataPixel(layerList[i].Reader)
+		if nodata == nil {
+			xdraw.Draw(dst, b.Sub(rect.Min), sub, sp)
+			continue
 		}
 
-		// copy sub image
-		xdraw.Draw(m.(*ximage.MemPImage), b.Sub(rect.Min), sub, image.Pt(0, 0))
+		// the nodata pixels are transparent
+		pixSize := len(nodata)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				pix := sub.XPix[sub.PixOffset(sp.X+x-b.Min.X, sp.Y+y-b.Min.Y):][:pixSize]
+				if !bytes.Equal(pix, nodata) {
+					copy(dst.XPix[dst.PixOffset(x-rect.Min.X, y-rect.Min.Y):], pix)
+				}
+			}
+		}
 	}
 
 	// OK
-	return
+	return dst, nil
+}
+
+// nodataPixel returns the nodata pixel of the layer reader,
+// or nil if the layer has no transparent pixels.
+func (p *_MultiImageReader) nodataPixel(r ImageReader) []byte {
+	if p.compose != ComposeNoDataLast {
+		return nil
+	}
+	v, ok := 0.0, false
+	if p.nodata != nil {
+		v, ok = *p.nodata, true
+	} else if x, _ := r.(NoDataImage); x != nil {
+		v, ok = x.NoData()
+	}
+	if !ok {
+		return nil
+	}
+	pix := make([]byte, ximage.SizeofPixel(p.channels, p.dataType))
+	for k := 0; k < p.channels; k++ {
+		ximage.PixSlice(pix).SetValue(k, p.dataType, v)
+	}
+	return pix
 }
+
 func (p *_MultiImageReader) ReadOverview(idxOverview int, rect image.Rectangle) (m image.Image, err error) {
-	if len(p.readers) == 0 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.layers) == 0 {
 		return nil, errors.New("image/big: _MultiImageReader.ReadOverview, no reader!")
 	}
 	if idxOverview < 0 {
@@ -181,25 +478,27 @@ func (p *_MultiImageReader) ReadOverview(idxOverview int, rect image.Rectangle)
 	}
 
 	if idxOverview == 0 {
-		return p.Read(rect)
+		return p.read(rect)
 	}
 
-	if len(p.readers) != 1 {
-		return nil, ErrNoOverviewsFeature
-	}
-	if !p.HasOverviewsFeature() {
+	if len(p.layers) != 1 {
 		return nil, ErrNoOverviewsFeature
 	}
-	if !p.HasOverviews() {
-		return nil, ErrNoOverviews
-	}
 
 	// only on image, start at (0,0)
-	if len(p.readers) == 1 && p.rect.Min == image.Pt(0, 0) {
-		for _, r := range p.readers {
-			return r.ReadOverview(idxOverview, rect)
-		}
+	if p.rect.Min != image.Pt(0, 0) {
+		return nil, ErrNoOverviews
 	}
-
-	return nil, ErrNoOverviews
+	r := p.layers[0].Reader
+	err = p.locks.do(r, func() (err error) {
+		if !r.HasOverviewsFeature() {
+			return ErrNoOverviewsFeature
+		}
+		if !r.HasOverviews() {
+			return ErrNoOverviews
+		}
+		m, err = r.ReadOverview(idxOverview, rect)
+		return
+	})
+	return
 }
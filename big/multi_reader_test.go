@@ -0,0 +1,164 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ximage "github.com/chai2010/image"
+)
+
+// tSerialImageReader fails if it is called concurrently.
+type tSerialImageReader struct {
+	ImageReader
+	busy     int32
+	inflight *int32 // of all the readers
+	maxIn    *int32
+}
+
+func (p *tSerialImageReader) Read(r image.Rectangle) (image.Image, error) {
+	if !atomic.CompareAndSwapInt32(&p.busy, 0, 1) {
+		return nil, errors.New("concurrent Read")
+	}
+	defer atomic.StoreInt32(&p.busy, 0)
+
+	n := atomic.AddInt32(p.inflight, 1)
+	defer atomic.AddInt32(p.inflight, -1)
+	for {
+		if max := atomic.LoadInt32(p.maxIn); n <= max || atomic.CompareAndSwapInt32(p.maxIn, max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return p.ImageReader.Read(r)
+}
+
+func TestMultiImageReader_concurrent(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	src := tNewPattern(image.Rect(0, 0, 200, 160), 1, reflect.Uint8)
+	var inflight, maxIn int32
+
+	readers := make(map[image.Rectangle]ImageReader)
+	for y := 0; y < 160; y += 80 {
+		for x := 0; x < 200; x += 100 {
+			b := image.Rect(x, y, x+100, y+80)
+			filename := filepath.Join(dir, fmt.Sprintf("%d-%d.raw", x, y))
+			w, err := CreateImageWriter("raw", filename, 100, 80, 1, reflect.Uint8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Write(image.Rect(0, 0, 100, 80), src.SubImage(b)); err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+
+			r, err := OpenImageReader(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			readers[b] = &tSerialImageReader{ImageReader: r, inflight: &inflight, maxIn: &maxIn}
+		}
+	}
+
+	r := MultiImageReaderWithOptions(readers, &MultiOptions{Workers: 4})
+	defer r.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rect := image.Rect(50+i, 40+i, 150+i, 120)
+			m, err := r.Read(rect)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			tEqualRect(t, m, src, rect)
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&maxIn); n < 2 {
+		t.Fatalf("sub-readers not read in parallel: %d", n)
+	}
+}
+
+// tConstImageReader is a w x h image of the value v.
+type tConstImageReader struct {
+	ImageReader
+	w, h   int
+	v      byte
+	nodata *float64
+}
+
+func (p *tConstImageReader) Width() int             { return p.w }
+func (p *tConstImageReader) Height() int            { return p.h }
+func (p *tConstImageReader) Channels() int          { return 1 }
+func (p *tConstImageReader) DataType() reflect.Kind { return reflect.Uint8 }
+func (p *tConstImageReader) Close() error           { return nil }
+func (p *tConstImageReader) HasOverviews() bool     { return false }
+func (p *tConstImageReader) HasOverviewsFeature() bool {
+	return false
+}
+
+func (p *tConstImageReader) Read(r image.Rectangle) (image.Image, error) {
+	m := image.NewGray(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if x < p.w && y < p.h && !(x == 0 && y == 0) {
+				m.Pix[m.PixOffset(x-r.Min.X, y-r.Min.Y)] = p.v
+			}
+		}
+	}
+	return m, nil
+}
+
+func (p *tConstImageReader) NoData() (float64, bool) {
+	if p.nodata == nil {
+		return 0, false
+	}
+	return *p.nodata, true
+}
+
+func TestMultiImageReader_compose(t *testing.T) {
+	zero := 0.0
+	layers := []MultiLayer{
+		{image.Rect(0, 0, 4, 4), &tConstImageReader{w: 4, h: 4, v: 1, nodata: &zero}},
+		{image.Rect(2, 0, 6, 4), &tConstImageReader{w: 4, h: 4, v: 2, nodata: &zero}},
+	}
+	rect := image.Rect(0, 0, 8, 1)
+
+	for _, v := range []struct {
+		opt *MultiOptions
+		pix []byte
+	}{
+		// (0,0) of every layer is 0
+		{&MultiOptions{}, []byte{0, 1, 0, 2, 2, 2, 0, 0}},
+		{&MultiOptions{Compose: ComposeFirstWins}, []byte{0, 1, 1, 1, 2, 2, 0, 0}},
+		{&MultiOptions{Compose: ComposeNoDataLast}, []byte{0, 1, 1, 2, 2, 2, 0, 0}},
+		{&MultiOptions{Compose: ComposeNoDataLast, Fill: []float64{9}}, []byte{9, 1, 1, 2, 2, 2, 9, 9}},
+	} {
+		r := MultiImageReaderFromLayers(layers, v.opt)
+		m, err := r.Read(rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pix := m.(*ximage.MemPImage).XPix; !bytes.Equal(pix, v.pix) {
+			t.Fatalf("%+v: %v != %v", v.opt, pix, v.pix)
+		}
+	}
+}
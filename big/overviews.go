@@ -0,0 +1,53 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+)
+
+// OverviewsProgress is the state of an overviews build.
+type OverviewsProgress struct {
+	Level      int // the overview level in building, 1 is the first
+	Levels     int // number of overview levels
+	Tiles      int // tiles done, of all the levels
+	TotalTiles int // tiles of all the levels
+}
+
+// ProgressFunc is called after each tile, it must not call the image.
+type ProgressFunc func(p OverviewsProgress)
+
+// OverviewsBuilderContext is implemented by the images which can build
+// the overviews with cancellation and progress. A cancelled build returns
+// ctx.Err() and leaves the image without overviews.
+type OverviewsBuilderContext interface {
+	BuildOverviewsContext(ctx context.Context, progress ProgressFunc) error
+	BuildOverviewsIfNotExistsContext(ctx context.Context, progress ProgressFunc) error
+}
+
+// BuildOverviewsContext builds the overviews of r with cancellation and
+// progress, if r does not implement OverviewsBuilderContext, the context
+// is only checked before BuildOverviews and progress is not called.
+func BuildOverviewsContext(ctx context.Context, r ImageReader, progress ProgressFunc) error {
+	if x, ok := r.(OverviewsBuilderContext); ok {
+		return x.BuildOverviewsContext(ctx, progress)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.BuildOverviews()
+}
+
+// BuildOverviewsIfNotExistsContext is like BuildOverviewsContext,
+// but does nothing if the overviews exist.
+func BuildOverviewsIfNotExistsContext(ctx context.Context, r ImageReader, progress ProgressFunc) error {
+	if x, ok := r.(OverviewsBuilderContext); ok {
+		return x.BuildOverviewsIfNotExistsContext(ctx, progress)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.BuildOverviewsIfNotExists()
+}
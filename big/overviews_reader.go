@@ -5,39 +5,55 @@
 package big
 
 import (
+	"context"
 	"errors"
 	"image"
 	"reflect"
+	"sync"
 )
 
 var (
 	_ ImageReader = (*_MultiOverviewImageReader)(nil)
+	_ GeoImage    = (*_MultiOverviewImageReader)(nil)
+
+	_ MetadataImage = (*_MultiOverviewImageReader)(nil)
+
+	_ OverviewsBuilderContext = (*_MultiOverviewImageReader)(nil)
 )
 
 type _MultiOverviewImageReader struct {
+	mu      sync.RWMutex // Close vs the others
 	readers []*_MultiImageReader
 }
 
-func newMultiOverviewImageReader(readers []map[image.Rectangle]ImageReader) *_MultiOverviewImageReader {
+func newMultiOverviewImageReader(readers [][]MultiLayer, opt *MultiOptions) *_MultiOverviewImageReader {
 	if len(readers) == 0 {
 		return &_MultiOverviewImageReader{}
 	}
 
+	// the levels may share the drivers
+	locks := make(_ReaderLocks)
+
 	p := &_MultiOverviewImageReader{}
 	for i := 0; i < len(readers); i++ {
-		r := newMultiImageReader(readers[i])
+		r := newMultiImageReader(readers[i], opt, locks)
 		p.readers = append(p.readers, r)
 	}
 	return p
 }
 
 func (p *_MultiOverviewImageReader) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	if len(p.readers) == 0 {
 		return nil
 	}
+	// the levels may share the drivers, each one is closed once
 	var firstErr error
+	closed := make(map[ImageReader]bool)
 	for i := 0; i < len(p.readers); i++ {
-		if err := p.readers[i].Close(); err != nil && firstErr == nil {
+		if err := p.readers[i].close(closed); err != nil && firstErr == nil {
 			firstErr = err
 		}
 	}
@@ -46,55 +62,108 @@ func (p *_MultiOverviewImageReader) Close() error {
 }
 
 func (p *_MultiOverviewImageReader) Width() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return 0
 	}
 	return p.readers[0].Width()
 }
 func (p *_MultiOverviewImageReader) Height() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return 0
 	}
 	return p.readers[0].Height()
 }
 func (p *_MultiOverviewImageReader) Channels() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return 0
 	}
 	return p.readers[0].Channels()
 }
 func (p *_MultiOverviewImageReader) DataType() reflect.Kind {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return reflect.Invalid
 	}
 	return p.readers[0].DataType()
 }
 
+func (p *_MultiOverviewImageReader) GeoReference() (g *GeoReference, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.readers) == 0 {
+		return nil, false
+	}
+	return p.readers[0].GeoReference()
+}
+
+func (p *_MultiOverviewImageReader) Metadata() (md *Metadata, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.readers) == 0 {
+		return nil, false
+	}
+	return p.readers[0].Metadata()
+}
+
 func (p *_MultiOverviewImageReader) HasOverviews() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return false
 	}
 	return len(p.readers) > 1
 }
 func (p *_MultiOverviewImageReader) HasOverviewsFeature() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return false
 	}
 	return len(p.readers) > 1
 }
 func (p *_MultiOverviewImageReader) BuildOverviews() error {
+	return p.BuildOverviewsContext(context.Background(), nil)
+}
+func (p *_MultiOverviewImageReader) BuildOverviewsIfNotExists() error {
+	return p.BuildOverviewsIfNotExistsContext(context.Background(), nil)
+}
+func (p *_MultiOverviewImageReader) BuildOverviewsContext(ctx context.Context, progress ProgressFunc) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return errors.New("image/big: _MultiOverviewImageReader.BuildOverviews, no reader!")
 	}
-	return p.readers[len(p.readers)-1].BuildOverviews()
+	return p.readers[len(p.readers)-1].BuildOverviewsContext(ctx, progress)
 }
-func (p *_MultiOverviewImageReader) BuildOverviewsIfNotExists() error {
+func (p *_MultiOverviewImageReader) BuildOverviewsIfNotExistsContext(ctx context.Context, progress ProgressFunc) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return errors.New("image/big: _MultiOverviewImageReader.BuildOverviewsIfNotExists, no reader!")
 	}
-	return p.readers[len(p.readers)-1].BuildOverviewsIfNotExists()
+	return p.readers[len(p.readers)-1].BuildOverviewsIfNotExistsContext(ctx, progress)
 }
 func (p *_MultiOverviewImageReader) Read(rect image.Rectangle) (m image.Image, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return nil, errors.New("image/big: _MultiOverviewImageReader.Read, no reader!")
 	}
@@ -104,6 +173,9 @@ func (p *_MultiOverviewImageReader) Read(rect image.Rectangle) (m image.Image, e
 	return p.readers[0].Read(rect)
 }
 func (p *_MultiOverviewImageReader) ReadOverview(idxOverview int, rect image.Rectangle) (m image.Image, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.readers) == 0 {
 		return nil, errors.New("image/big: _MultiOverviewImageReader.ReadOverview, no reader!")
 	}
@@ -117,9 +189,12 @@ func (p *_MultiOverviewImageReader) ReadOverview(idxOverview int, rect image.Rec
 	if idxOverview < len(p.readers) {
 		return p.readers[idxOverview].Read(rect)
 	} else {
-		return p.readers[idxOverview].ReadOverview(
-			idxOverview-len(p.readers)-1,
-			rect,
-		)
+		// the overviews of the last level
+		last := len(p.readers) - 1
+		m, err = p.readers[last].ReadOverview(idxOverview-last, rect)
+		if err == ErrNoOverviews || err == ErrNoOverviewsFeature {
+			err = ErrOverviewIndex
+		}
+		return
 	}
 }
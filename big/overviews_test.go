@@ -0,0 +1,80 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"image"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildOverviewsContext(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	src := tNewPattern(image.Rect(0, 0, 100, 60), 1, reflect.Uint8)
+	w, err := CreateImageWriterWithOptions("raw", filename, 100, 60, 1, reflect.Uint8, &CreateOptions{
+		TileSize: image.Pt(16, 16),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	r0, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r0.Close()
+	r := CacheImageReader(r0, nil)
+
+	// 50x30: 4x2, 25x15: 2x1, 12x7: 1x1
+	var last OverviewsProgress
+	err = BuildOverviewsContext(context.Background(), r, func(p OverviewsProgress) {
+		if p.Tiles != last.Tiles+1 || p.Level < last.Level {
+			t.Fatalf("bad progress: %+v after %+v", p, last)
+		}
+		last = p
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (OverviewsProgress{Level: 3, Levels: 3, Tiles: 11, TotalTiles: 11}); last != want {
+		t.Fatalf("bad progress: %+v != %+v", last, want)
+	}
+	if !r.HasOverviews() {
+		t.Fatal("expect overviews")
+	}
+
+	// a cancelled rebuild leaves no overviews
+	ctx, cancel := context.WithCancel(context.Background())
+	err = BuildOverviewsContext(ctx, r, func(p OverviewsProgress) {
+		if p.Tiles == 5 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	if r.HasOverviews() {
+		t.Fatal("expect no overviews")
+	}
+	if _, err := r0.ReadOverview(1, image.Rect(0, 0, 10, 10)); err != ErrNoOverviews {
+		t.Fatalf("expect ErrNoOverviews, got %v", err)
+	}
+
+	if err := BuildOverviewsIfNotExistsContext(context.Background(), r, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !r.HasOverviews() {
+		t.Fatal("expect overviews")
+	}
+}
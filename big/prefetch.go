@@ -0,0 +1,328 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+
+	ximage "github.com/chai2010/image"
+)
+
+const (
+	DefaultPrefetchBlockSize = 256
+	DefaultPrefetchBlocks    = 4
+)
+
+// BlockIteratorOptions tells which blocks NewBlockIterator reads.
+type BlockIteratorOptions struct {
+	Level     int             // the overview level, 0 is the image
+	Rect      image.Rectangle // the scanned rect of the level, the level if empty
+	BlockSize image.Point     // the TileSize of a TiledImage, or DefaultPrefetchBlockSize
+	Prefetch  int             // blocks read ahead, DefaultPrefetchBlocks if 0, none if < 0
+	MaxBytes  int             // bytes of the read blocks, 0 is unlimited
+	Workers   int             // concurrent reads, default is 1, > 1 needs r safe for concurrent use
+}
+
+// Block is a block of the BlockIterator, Image bounds is (0,0)-(Rect.Dx(),Rect.Dy()).
+type Block struct {
+	Rect  image.Rectangle
+	Image *ximage.MemPImage
+}
+
+type _BlockResult struct {
+	m   *ximage.MemPImage
+	err error
+}
+
+// BlockIterator reads the blocks of a rect in row-major order, the next
+// blocks are read in background while the current one is processed:
+//
+//	it, err := big.NewBlockIterator(ctx, r, nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		b := it.Block()
+//		...
+//	}
+//	return it.Err()
+//
+// The current block is released by the next call of Next, it counts in
+// MaxBytes until then. A block is always read if no other block is held,
+// so a block bigger than MaxBytes can not block the iterator.
+//
+// The reads are in background goroutines, but one at a time, so r is not
+// required to be safe for concurrent use. Workers > 1 reads the blocks
+// concurrently, only if r is safe for it.
+type BlockIterator struct {
+	r      ImageReader
+	level  int
+	rect   image.Rectangle
+	size   image.Point
+	across int
+	count  int
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pending chan chan _BlockResult
+	reads   chan struct{} // the running reads, up to Workers
+	budget  *_ByteBudget
+	wg      sync.WaitGroup
+
+	idx      int // index of the current block
+	cur      Block
+	curBytes int
+	err      error
+}
+
+// NewBlockIterator returns an iterator over the blocks of r, it must be closed.
+func NewBlockIterator(ctx context.Context, r ImageReader, opt *BlockIteratorOptions) (*BlockIterator, error) {
+	if opt == nil {
+		opt = new(BlockIteratorOptions)
+	}
+	if opt.Level < 0 {
+		return nil, fmt.Errorf("image/big: NewBlockIterator, invalid level: %d", opt.Level)
+	}
+
+	lb := image.Rectangle{Max: levelSize(r.Width(), r.Height(), opt.Level)}
+	rect := opt.Rect
+	if rect.Empty() {
+		rect = lb
+	}
+	if !rect.In(lb) {
+		return nil, fmt.Errorf("image/big: NewBlockIterator, invalid rect: %v", rect)
+	}
+
+	size := opt.BlockSize
+	if size == (image.Point{}) {
+		size = image.Pt(DefaultPrefetchBlockSize, DefaultPrefetchBlockSize)
+		if t, ok := r.(TiledImage); ok {
+			if sz := t.TileSize(); sz.X > 0 && sz.Y > 0 {
+				size = sz
+			}
+		}
+	}
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, fmt.Errorf("image/big: NewBlockIterator, invalid block size: %v", size)
+	}
+
+	prefetch := opt.Prefetch
+	switch {
+	case prefetch == 0:
+		prefetch = DefaultPrefetchBlocks
+	case prefetch < 0:
+		prefetch = 0
+	}
+
+	workers := opt.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	it := &BlockIterator{
+		r:       r,
+		level:   opt.Level,
+		rect:    rect,
+		size:    size,
+		across:  (rect.Dx() + size.X - 1) / size.X,
+		pending: make(chan chan _BlockResult, prefetch),
+		reads:   make(chan struct{}, workers),
+		budget:  newByteBudget(opt.MaxBytes),
+		idx:     -1,
+	}
+	it.count = it.across * ((rect.Dy() + size.Y - 1) / size.Y)
+	it.ctx, it.cancel = context.WithCancel(ctx)
+
+	it.wg.Add(1)
+	go it.dispatch()
+	return it, nil
+}
+
+// levelSize returns the size of the overview level, the levels are
+// halved until 1x1.
+func levelSize(width, height, level int) image.Point {
+	for ; level > 0 && (width > 1 || height > 1); level-- {
+		width, height = maxInt(width/2, 1), maxInt(height/2, 1)
+	}
+	return image.Pt(width, height)
+}
+
+// blockRect returns the rect of the block i, clipped to the scanned rect.
+func (it *BlockIterator) blockRect(i int) image.Rectangle {
+	col, row := i%it.across, i/it.across
+	min := it.rect.Min.Add(image.Pt(col*it.size.X, row*it.size.Y))
+	return image.Rectangle{Min: min, Max: min.Add(it.size)}.Intersect(it.rect)
+}
+
+func (it *BlockIterator) blockBytes(r image.Rectangle) int {
+	return r.Dx() * r.Dy() * ximage.SizeofPixel(it.r.Channels(), it.r.DataType())
+}
+
+// dispatch starts the reads of the blocks in order, it waits when the
+// pending queue is full, the budget is exhausted or Workers reads run.
+func (it *BlockIterator) dispatch() {
+	defer it.wg.Done()
+	defer close(it.pending)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-it.ctx.Done():
+			it.budget.Close()
+		case <-stop:
+		}
+	}()
+
+	for i := 0; i < it.count; i++ {
+		r := it.blockRect(i)
+		n := it.blockBytes(r)
+		if !it.budget.Acquire(n) {
+			return
+		}
+		select {
+		case it.reads <- struct{}{}:
+		case <-it.ctx.Done():
+			it.budget.Release(n)
+			return
+		}
+		ch := make(chan _BlockResult, 1)
+		select {
+		case it.pending <- ch:
+		case <-it.ctx.Done():
+			<-it.reads
+			it.budget.Release(n)
+			return
+		}
+
+		it.wg.Add(1)
+		go func() {
+			defer it.wg.Done()
+			m, err := it.readBlock(r)
+			<-it.reads
+			ch <- _BlockResult{m: m, err: err}
+		}()
+	}
+}
+
+func (it *BlockIterator) readBlock(r image.Rectangle) (*ximage.MemPImage, error) {
+	if err := it.ctx.Err(); err != nil {
+		return nil, err
+	}
+	var m image.Image
+	var err error
+	if it.level == 0 {
+		m, err = it.r.Read(r)
+	} else {
+		m, err = it.r.ReadOverview(it.level, r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := asMemPImage(m)
+	if p.XChannels != it.r.Channels() || p.XDataType != it.r.DataType() {
+		return nil, errors.New("image/big: BlockIterator.Next, pixel type mismatch!")
+	}
+	return p, nil
+}
+
+// Next advances to the next block, it returns false at the end or on the
+// first error.
+func (it *BlockIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.budget.Release(it.curBytes)
+	it.cur, it.curBytes = Block{}, 0
+
+	ch, ok := <-it.pending
+	if !ok {
+		if it.idx+1 < it.count {
+			it.err = it.ctx.Err()
+		}
+		return false
+	}
+	res := <-ch
+	if res.err != nil {
+		it.err = res.err
+		it.cancel()
+		return false
+	}
+
+	it.idx++
+	r := it.blockRect(it.idx)
+	it.cur, it.curBytes = Block{Rect: r, Image: res.m}, it.blockBytes(r)
+	return true
+}
+
+// Block returns the current block.
+func (it *BlockIterator) Block() Block {
+	return it.cur
+}
+
+// Err returns the first error of Next.
+func (it *BlockIterator) Err() error {
+	return it.err
+}
+
+// Close stops the prefetching and waits for the running reads.
+func (it *BlockIterator) Close() error {
+	it.cancel()
+	it.wg.Wait()
+	it.cur = Block{}
+	return nil
+}
+
+// _ByteBudget bounds the bytes of the blocks, but always admits one
+// block when nothing is held.
+type _ByteBudget struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	max    int
+	used   int
+	closed bool
+}
+
+func newByteBudget(max int) *_ByteBudget {
+	p := &_ByteBudget{max: max}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Acquire waits for n bytes, it returns false if the budget is closed.
+func (p *_ByteBudget) Acquire(n int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.closed && p.max > 0 && p.used > 0 && p.used+n > p.max {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return false
+	}
+	p.used += n
+	return true
+}
+
+func (p *_ByteBudget) Release(n int) {
+	if n == 0 {
+		return
+	}
+	p.mu.Lock()
+	p.used -= n
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+func (p *_ByteBudget) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"errors"
+	"image"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tBlockImageReader counts the started reads, and fails the reads at fail.
+type tBlockImageReader struct {
+	ImageReader
+	reads int64
+	fail  image.Point
+}
+
+func (p *tBlockImageReader) Read(r image.Rectangle) (image.Image, error) {
+	atomic.AddInt64(&p.reads, 1)
+	if r.Min == p.fail {
+		return nil, errors.New("read error")
+	}
+	return p.ImageReader.Read(r)
+}
+
+// tActiveImageReader records the max concurrent reads.
+type tActiveImageReader struct {
+	ImageReader
+	active, maxActive int64
+}
+
+func (p *tActiveImageReader) Read(r image.Rectangle) (image.Image, error) {
+	n := atomic.AddInt64(&p.active, 1)
+	defer atomic.AddInt64(&p.active, -1)
+	for {
+		v := atomic.LoadInt64(&p.maxActive)
+		if n <= v || atomic.CompareAndSwapInt64(&p.maxActive, v, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return p.ImageReader.Read(r)
+}
+
+func TestBlockIterator(t *testing.T) {
+	src := tNewPattern(image.Rect(0, 0, 100, 70), 2, reflect.Uint8)
+	r := &tBlockImageReader{ImageReader: NewMemImage(src), fail: image.Pt(-1, -1)}
+
+	// 2 blocks of the budget, one is held by the loop
+	it, err := NewBlockIterator(context.Background(), r, &BlockIteratorOptions{
+		Rect:      image.Rect(4, 5, 100, 69),
+		BlockSize: image.Pt(32, 16),
+		Prefetch:  8,
+		MaxBytes:  2 * 32 * 16 * 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	var blocks []image.Rectangle
+	for it.Next() {
+		if n := atomic.LoadInt64(&r.reads); n > int64(len(blocks))+2 {
+			t.Fatalf("block %d: %d reads started", len(blocks), n)
+		}
+		b := it.Block()
+		tEqualRect(t, b.Image, src, b.Rect)
+		blocks = append(blocks, b.Rect)
+		time.Sleep(time.Millisecond)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 96x64 in 32x16: 3x4, row-major
+	if len(blocks) != 12 {
+		t.Fatalf("bad blocks: %v", blocks)
+	}
+	for i, want := range []image.Rectangle{
+		0:  image.Rect(4, 5, 36, 21),
+		2:  image.Rect(68, 5, 100, 21),
+		3:  image.Rect(4, 21, 36, 37),
+		11: image.Rect(68, 53, 100, 69),
+	} {
+		if want != (image.Rectangle{}) && blocks[i] != want {
+			t.Fatalf("block %d: %v != %v", i, blocks[i], want)
+		}
+	}
+}
+
+func TestBlockIterator_error(t *testing.T) {
+	src := tNewPattern(image.Rect(0, 0, 64, 64), 1, reflect.Uint16)
+	r := &tBlockImageReader{ImageReader: NewMemImage(src), fail: image.Pt(32, 16)}
+
+	it, err := NewBlockIterator(context.Background(), r, &BlockIteratorOptions{
+		BlockSize: image.Pt(16, 16),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if it.Err() == nil || n != 6 {
+		t.Fatalf("expect error after 6 blocks, got %d, %v", n, it.Err())
+	}
+	it.Close()
+
+	// a cancelled scan
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.fail = image.Pt(-1, -1)
+	it, err = NewBlockIterator(ctx, r, &BlockIteratorOptions{
+		BlockSize: image.Pt(8, 8),
+		Prefetch:  -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	for n = 0; it.Next(); n++ {
+		if n == 3 {
+			cancel()
+		}
+	}
+	if it.Err() != context.Canceled || n >= 64 {
+		t.Fatalf("expect context.Canceled, got %d, %v", n, it.Err())
+	}
+
+	if _, err := NewBlockIterator(context.Background(), r, &BlockIteratorOptions{Rect: image.Rect(0, 0, 65, 10)}); err == nil {
+		t.Fatal("expect invalid rect")
+	}
+}
+
+func TestBlockIterator_workers(t *testing.T) {
+	src := tNewPattern(image.Rect(0, 0, 64, 64), 1, reflect.Uint8)
+	for _, workers := range []int{0, 1, 3} {
+		r := &tActiveImageReader{ImageReader: NewMemImage(src)}
+		it, err := NewBlockIterator(context.Background(), r, &BlockIteratorOptions{
+			BlockSize: image.Pt(8, 8),
+			Prefetch:  16,
+			Workers:   workers,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for ; it.Next(); n++ {
+			b := it.Block()
+			tEqualRect(t, b.Image, src, b.Rect)
+		}
+		if err := it.Close(); err != nil || it.Err() != nil || n != 64 {
+			t.Fatalf("workers %d: %d blocks, %v, %v", workers, n, err, it.Err())
+		}
+		if max := maxInt(workers, 1); r.maxActive > int64(max) {
+			t.Fatalf("workers %d: %d concurrent reads", workers, r.maxActive)
+		}
+	}
+}
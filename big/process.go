@@ -0,0 +1,185 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"runtime"
+	"sync"
+
+	ximage "github.com/chai2010/image"
+)
+
+const (
+	DefaultProcessBlockSize = 256
+)
+
+// ProcessFunc computes r of dst from src. The bounds of src is r with the
+// halo and the bounds of dst is r, both in the image coordinates; the
+// halo outside the image is zero. dst is zero, it has the pixel type of
+// the writer.
+type ProcessFunc func(dst, src *ximage.MemPImage, r image.Rectangle) error
+
+// ProcessOptions are the options of ProcessBlocks.
+type ProcessOptions struct {
+	BlockSize image.Point           // the TileSize of a TiledImage writer, or DefaultProcessBlockSize
+	Halo      int                   // pixels read around every block
+	Workers   int                   // runtime.NumCPU() if 0
+	Progress  func(done, total int) // called after each written block
+}
+
+type _ProcessResult struct {
+	m   *ximage.MemPImage
+	err error
+}
+
+// ProcessBlocks applies fn to the blocks of src and writes the results to
+// dst in row-major order. The blocks are computed by opt.Workers goroutines,
+// about 2*Workers blocks are in memory. dst must have the size of src,
+// and must not be src. The overviews of dst are not built.
+//
+// Only fn runs concurrently, the reads of src and the writes of dst are
+// serialized, so the drivers are not required to be safe for concurrent
+// use.
+func ProcessBlocks(ctx context.Context, dst ImageWriter, src ImageReader, fn ProcessFunc, opt *ProcessOptions) error {
+	if opt == nil {
+		opt = new(ProcessOptions)
+	}
+	if dst.Width() != src.Width() || dst.Height() != src.Height() {
+		return fmt.Errorf("image/big: ProcessBlocks, size mismatch: %dx%d != %dx%d",
+			dst.Width(), dst.Height(), src.Width(), src.Height(),
+		)
+	}
+	if opt.Halo < 0 {
+		return fmt.Errorf("image/big: ProcessBlocks, invalid halo: %d", opt.Halo)
+	}
+
+	size := opt.BlockSize
+	if size == (image.Point{}) {
+		size = image.Pt(DefaultProcessBlockSize, DefaultProcessBlockSize)
+		if t, ok := dst.(TiledImage); ok {
+			if sz := t.TileSize(); sz.X > 0 && sz.Y > 0 {
+				size = sz
+			}
+		}
+	}
+	if size.X <= 0 || size.Y <= 0 {
+		return fmt.Errorf("image/big: ProcessBlocks, invalid block size: %v", size)
+	}
+	workers := opt.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	bounds := image.Rect(0, 0, src.Width(), src.Height())
+	across := (bounds.Dx() + size.X - 1) / size.X
+	total := across * ((bounds.Dy() + size.Y - 1) / size.Y)
+	blockRect := func(i int) image.Rectangle {
+		x, y := i%across*size.X, i/across*size.Y
+		return image.Rect(x, y, x+size.X, y+size.Y).Intersect(bounds)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the blocks are started in order, and written in order
+	var ioMu sync.Mutex // src.Read and dst.Write
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	pending := make(chan chan _ProcessResult, workers)
+	sem := make(chan struct{}, workers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(pending)
+		for i := 0; i < total; i++ {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			ch := make(chan _ProcessResult, 1)
+			select {
+			case pending <- ch:
+			case <-ctx.Done():
+				<-sem
+				return
+			}
+
+			wg.Add(1)
+			go func(r image.Rectangle) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				m, err := processBlock(ctx, &ioMu, dst, src, fn, r, opt.Halo)
+				ch <- _ProcessResult{m: m, err: err}
+			}(blockRect(i))
+		}
+	}()
+
+	done := 0
+	for ch := range pending {
+		res := <-ch
+		if res.err != nil {
+			cancel()
+			return res.err
+		}
+		ioMu.Lock()
+		err := dst.Write(res.m.Bounds(), res.m)
+		ioMu.Unlock()
+		if err != nil {
+			cancel()
+			return err
+		}
+		done++
+		if opt.Progress != nil {
+			opt.Progress(done, total)
+		}
+	}
+	if done < total {
+		return ctx.Err()
+	}
+	return nil
+}
+
+func processBlock(ctx context.Context, ioMu *sync.Mutex, dst ImageWriter, src ImageReader, fn ProcessFunc, r image.Rectangle, halo int) (*ximage.MemPImage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sr := r.Inset(-halo)
+	ioMu.Lock()
+	m, err := src.Read(sr)
+	ioMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	in := asMemPImage(m)
+	if in.XChannels != src.Channels() || in.XDataType != src.DataType() {
+		return nil, errors.New("image/big: ProcessBlocks, pixel type mismatch!")
+	}
+	b := in.Bounds()
+	if b.Dx() < sr.Dx() || b.Dy() < sr.Dy() {
+		return nil, errors.New("image/big: ProcessBlocks, image too small!")
+	}
+
+	// a view in the image coordinates, the read result may be shared
+	in = &ximage.MemPImage{
+		XMemPMagic: ximage.MemPMagic,
+		XRect:      sr,
+		XChannels:  in.XChannels,
+		XDataType:  in.XDataType,
+		XPix:       in.XPix[in.PixOffset(b.Min.X, b.Min.Y):],
+		XStride:    in.XStride,
+	}
+
+	out := ximage.NewMemPImage(r, dst.Channels(), dst.DataType())
+	if err := fn(out, in, r); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"errors"
+	"image"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+)
+
+// tBoxFilter is the 3x3 sum of src divided by 9, the pixels outside src are zero.
+func tBoxFilter(dst, src *ximage.MemPImage, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sum := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if pt := image.Pt(x+dx, y+dy); pt.In(src.Bounds()) {
+						sum += int(src.PixelAt(pt.X, pt.Y)[0])
+					}
+				}
+			}
+			dst.SetPixel(x, y, []byte{byte(sum / 9)})
+		}
+	}
+}
+
+func TestProcessBlocks(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	src := tNewPattern(image.Rect(0, 0, 90, 50), 1, reflect.Uint8)
+	want := ximage.NewMemPImage(src.Bounds(), 1, reflect.Uint8)
+	tBoxFilter(want, src, src.Bounds())
+
+	w, err := CreateImageWriterWithOptions("raw", filepath.Join(dir, "a.raw"), 90, 50, 1, reflect.Uint8, &CreateOptions{
+		TileSize: image.Pt(16, 16),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// 90x50 in 16x16: 6x4, the reads are serialized
+	var last int
+	rs := &tActiveImageReader{ImageReader: NewMemImage(src)}
+	err = ProcessBlocks(context.Background(), w, rs, func(dst, in *ximage.MemPImage, r image.Rectangle) error {
+		if dst.Bounds() != r || in.Bounds() != r.Inset(-1) {
+			return errors.New("bad bounds")
+		}
+		tBoxFilter(dst, in, r)
+		return nil
+	}, &ProcessOptions{
+		Halo:    1,
+		Workers: 3,
+		Progress: func(done, total int) {
+			if done != last+1 || total != 24 {
+				t.Fatalf("bad progress: %d/%d", done, total)
+			}
+			last = done
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != 24 {
+		t.Fatalf("bad progress: %d", last)
+	}
+	if rs.maxActive != 1 {
+		t.Fatalf("%d concurrent reads", rs.maxActive)
+	}
+
+	got, err := w.(ImageReader).Read(src.Bounds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, got, want, src.Bounds())
+
+	// the first error stops the processing
+	errBlock := errors.New("block error")
+	err = ProcessBlocks(context.Background(), w, NewMemImage(src), func(dst, in *ximage.MemPImage, r image.Rectangle) error {
+		if r.Min == image.Pt(32, 16) {
+			return errBlock
+		}
+		return nil
+	}, &ProcessOptions{BlockSize: image.Pt(16, 16)})
+	if err != errBlock {
+		t.Fatalf("expect block error, got %v", err)
+	}
+
+	small, _ := CreateMemImage(90, 49, 1, reflect.Uint8)
+	if err := ProcessBlocks(context.Background(), w, small, nil, nil); err == nil {
+		t.Fatal("expect size error")
+	}
+}
@@ -0,0 +1,643 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
+	ximage "github.com/chai2010/image"
+)
+
+// Raw tiled file format (Little Endian):
+//
+//	Magic      [8]byte // "BigRaw\x00\x01"
+//	HeaderSize uint32  // 256
+//	Version    uint32  // 1
+//	Width      int32
+//	Height     int32
+//	Channels   int32
+//	DataType   int32   // reflect.Kind
+//	TileWidth  int32
+//	TileHeight int32
+//	Overviews  int32   // number of built overview levels
+//	ByteOrder  uint8   // byte order of the tiles, 0: little endian, 1: big endian
+//	Compress   uint8   // 0: none, else the id of RegisterTileCodec
+//	HasNoData  uint8
+//	Predictor  uint8   // 0: none, 1: horizontal differencing
+//	NoData     float64
+//	MetaOffset int64   // offset of the metadata, 0 if none
+//	MetaSize   int64
+//	Reserved   [184]byte
+//	Tiles      [Levels][TilesDown][TilesAcross]Tile
+//	Meta       [MetaSize]byte // JSON
+//
+// Every tile is TileWidth*TileHeight*SizeofPixel(Channels, DataType) bytes,
+// the edge tiles are padded with zero.
+//
+// The tiles of a compressed file are stored out of order, the header is
+// followed by the tile index:
+//
+//	Index      [Levels][TilesDown][TilesAcross]struct{ Offset, Size int64 }
+//
+// A tile of zero Size is zero. A written tile or metadata is appended to
+// the file, the space of the replaced one is not reused. The predictor is
+// applied before the byte order swap and the compression.
+//
+// Level 0 is the image, level i+1 is level i reduced by 2x, until the level
+// fits in one tile. The overview levels are only written by BuildOverviews.
+//
+// The metadata follows the last level, it is rewritten in place.
+const (
+	RawDriverName      = "raw"
+	RawDefaultTileSize = 256
+)
+
+const (
+	_RawMagic      = "BigRaw\x00\x01"
+	_RawHeaderSize = 256
+	_RawVersion    = 1
+)
+
+// the limits of a header, checked before any allocation
+const (
+	_RawMaxChannels  = 1 << 12
+	_RawMaxTileSize  = 1 << 16 // width or height
+	_RawMaxTileBytes = 1 << 28
+	_RawMaxImageSize = 1 << 50 // bytes of the level 0
+)
+
+const (
+	_RawLittleEndian = 0
+	_RawBigEndian    = 1
+)
+
+const (
+	_RawCompressNone = 0
+)
+
+const (
+	_RawPredictorNone       = 0
+	_RawPredictorHorizontal = 1
+)
+
+const (
+	isLittleEndian = (runtime.GOARCH == "386" ||
+		runtime.GOARCH == "amd64" ||
+		runtime.GOARCH == "arm" ||
+		runtime.GOARCH == "arm64")
+)
+
+var (
+	_ ImageReader = (*_RawImage)(nil)
+	_ ImageWriter = (*_RawImage)(nil)
+	_ NoDataImage = (*_RawImage)(nil)
+	_ TiledImage  = (*_RawImage)(nil)
+	_ GeoImage    = (*_RawImage)(nil)
+	_ GeoWriter   = (*_RawImage)(nil)
+
+	_ MetadataImage  = (*_RawImage)(nil)
+	_ MetadataWriter = (*_RawImage)(nil)
+)
+
+func init() {
+	RegisterImageReader(RawDriverName, openRawImageReader)
+	RegisterImageWriterWithOptions(RawDriverName, openRawImageWriter, createRawImageWriter)
+}
+
+type _RawHeader struct {
+	Magic      [8]byte
+	HeaderSize uint32
+	Version    uint32
+	Width      int32
+	Height     int32
+	Channels   int32
+	DataType   int32
+	TileWidth  int32
+	TileHeight int32
+	Overviews  int32
+	ByteOrder  uint8
+	Compress   uint8
+	HasNoData  uint8
+	Predictor  uint8
+	NoData     float64
+	MetaOffset int64
+	MetaSize   int64
+	Reserved   [_RawHeaderSize - 72]byte
+}
+
+type _RawLevel struct {
+	Width       int
+	Height      int
+	TilesAcross int
+	TilesDown   int
+	Offset      int64 // offset of the first tile
+	Index       int   // index of the first tile, in all the levels
+}
+
+type _RawImage struct {
+	mu        sync.RWMutex
+	f         *os.File
+	readOnly  bool
+	hdr       _RawHeader
+	meta      _RawMeta
+	levels    []_RawLevel
+	tileSize  image.Point
+	pixSize   int
+	tileBytes int
+	codec     TileCodec       // nil if not compressed
+	index     []_RawTileEntry // tile index of the compressed file
+	end       int64           // end of the compressed file
+}
+
+func openRawImageReader(filename string) (ImageReader, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		if f, err = os.Open(filename); err != nil {
+			return nil, err
+		}
+		p, err := newRawImage(f, true)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return p, nil
+	}
+	p, err := newRawImage(f, false)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func openRawImageWriter(filename string) (ImageWriter, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newRawImage(f, false)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func createRawImageWriter(format, filename string, width, height, channels int, dataType reflect.Kind, opt *CreateOptions) (ImageWriter, error) {
+	if !strings.EqualFold(format, RawDriverName) {
+		return nil, ErrFormat
+	}
+	if width <= 0 || height <= 0 || channels <= 0 || ximage.SizeofKind(dataType) == 0 {
+		return nil, fmt.Errorf("image/big: raw, invalid image: %dx%d, %d, %v", width, height, channels, dataType)
+	}
+	if opt == nil {
+		opt = new(CreateOptions)
+	}
+
+	hdr := _RawHeader{
+		HeaderSize: _RawHeaderSize,
+		Version:    _RawVersion,
+		Width:      int32(width),
+		Height:     int32(height),
+		Channels:   int32(channels),
+		DataType:   int32(dataType),
+		TileWidth:  RawDefaultTileSize,
+		TileHeight: RawDefaultTileSize,
+	}
+	copy(hdr.Magic[:], _RawMagic)
+
+	if opt.TileSize != (image.Point{}) {
+		if opt.TileSize.X <= 0 || opt.TileSize.Y <= 0 {
+			return nil, fmt.Errorf("image/big: raw, invalid tile size: %v", opt.TileSize)
+		}
+		hdr.TileWidth, hdr.TileHeight = int32(opt.TileSize.X), int32(opt.TileSize.Y)
+	}
+	id, codec, ok := lookupTileCodec(opt.Compression)
+	if !ok {
+		return nil, fmt.Errorf("image/big: raw, unsupported compression: %q", opt.Compression)
+	}
+	hdr.Compress = id
+	if opt.ReserveOverviews && codec != nil {
+		return nil, errors.New("image/big: raw, can not reserve the overviews of a compressed file")
+	}
+	switch strings.ToLower(opt.Predictor) {
+	case "", "none":
+		hdr.Predictor = _RawPredictorNone
+	case "horizontal":
+		if codec == nil {
+			return nil, errors.New("image/big: raw, predictor without compression")
+		}
+		if !isIntegerKind(dataType) {
+			return nil, fmt.Errorf("image/big: raw, predictor of %v", dataType)
+		}
+		hdr.Predictor = _RawPredictorHorizontal
+	default:
+		return nil, fmt.Errorf("image/big: raw, unsupported predictor: %q", opt.Predictor)
+	}
+	switch opt.ByteOrder {
+	case nil, binary.LittleEndian:
+		hdr.ByteOrder = _RawLittleEndian
+	case binary.BigEndian:
+		hdr.ByteOrder = _RawBigEndian
+	default:
+		return nil, fmt.Errorf("image/big: raw, unsupported byte order: %v", opt.ByteOrder)
+	}
+	if opt.NoData != nil {
+		hdr.HasNoData, hdr.NoData = 1, *opt.NoData
+	}
+	if err := hdr.validate(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := &_RawImage{f: f, hdr: hdr, codec: codec}
+	p.initLayout()
+
+	if err = p.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// the file is sparse until the tiles are written, the index is zero
+	end := p.imageEnd()
+	if opt.ReserveOverviews {
+		end = p.levelEnd(len(p.levels) - 1)
+	}
+	if codec != nil {
+		p.index, p.end = make([]_RawTileEntry, p.tileCount()), end
+	}
+	if err = f.Truncate(end); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func newRawImage(f *os.File, readOnly bool) (*_RawImage, error) {
+	p := &_RawImage{f: f, readOnly: readOnly}
+	if err := binary.Read(io.NewSectionReader(f, 0, _RawHeaderSize), binary.LittleEndian, &p.hdr); err != nil {
+		return nil, ErrFormat
+	}
+	if string(p.hdr.Magic[:]) != _RawMagic {
+		return nil, ErrFormat
+	}
+	if err := p.hdr.validate(); err != nil {
+		return nil, err
+	}
+	p.codec, _ = lookupTileCodecByID(p.hdr.Compress)
+	p.initLayout()
+
+	// the image or the tile index must be in the file
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if end := p.imageEnd(); fi.Size() < end {
+		return nil, fmt.Errorf("image/big: raw, file too small: %d < %d", fi.Size(), end)
+	}
+	if p.codec != nil {
+		if err := p.readIndex(fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.readMeta(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (hdr *_RawHeader) validate() error {
+	switch {
+	case hdr.HeaderSize < _RawHeaderSize:
+		return fmt.Errorf("image/big: raw, bad header size: %d", hdr.HeaderSize)
+	case hdr.Version != _RawVersion:
+		return fmt.Errorf("image/big: raw, unsupported version: %d", hdr.Version)
+	case hdr.Width <= 0 || hdr.Height <= 0:
+		return fmt.Errorf("image/big: raw, bad size: %dx%d", hdr.Width, hdr.Height)
+	case hdr.Channels <= 0 || hdr.Channels > _RawMaxChannels || ximage.SizeofKind(reflect.Kind(hdr.DataType)) == 0:
+		return fmt.Errorf("image/big: raw, bad pixel type: %d, %v", hdr.Channels, reflect.Kind(hdr.DataType))
+	case hdr.TileWidth <= 0 || hdr.TileHeight <= 0 || hdr.TileWidth > _RawMaxTileSize || hdr.TileHeight > _RawMaxTileSize:
+		return fmt.Errorf("image/big: raw, bad tile size: %dx%d", hdr.TileWidth, hdr.TileHeight)
+	case hdr.tileBytes() > _RawMaxTileBytes:
+		return fmt.Errorf("image/big: raw, tile too big: %d", hdr.tileBytes())
+	case hdr.imageBytes() > _RawMaxImageSize:
+		return fmt.Errorf("image/big: raw, image too big: %d", hdr.imageBytes())
+	case hdr.Overviews < 0:
+		return fmt.Errorf("image/big: raw, bad overviews: %d", hdr.Overviews)
+	case hdr.ByteOrder != _RawLittleEndian && hdr.ByteOrder != _RawBigEndian:
+		return fmt.Errorf("image/big: raw, bad byte order: %d", hdr.ByteOrder)
+	case !isTileCodec(hdr.Compress):
+		return fmt.Errorf("image/big: raw, unsupported compression: %d", hdr.Compress)
+	case hdr.Predictor > _RawPredictorHorizontal:
+		return fmt.Errorf("image/big: raw, unsupported predictor: %d", hdr.Predictor)
+	case hdr.Predictor != _RawPredictorNone && (hdr.Compress == _RawCompressNone || !isIntegerKind(reflect.Kind(hdr.DataType))):
+		return fmt.Errorf("image/big: raw, bad predictor: %d", hdr.Predictor)
+	case hdr.MetaOffset < 0 || hdr.MetaSize < 0 || hdr.MetaSize > _RawMaxMetaSize:
+		return fmt.Errorf("image/big: raw, bad metadata: %d, %d", hdr.MetaOffset, hdr.MetaSize)
+	}
+	return nil
+}
+
+// tileBytes returns the size of a tile, it does not overflow when the
+// channels and the tile size are in the limits.
+func (hdr *_RawHeader) tileBytes() int64 {
+	pixSize := int64(hdr.Channels) * int64(ximage.SizeofKind(reflect.Kind(hdr.DataType)))
+	return int64(hdr.TileWidth) * int64(hdr.TileHeight) * pixSize
+}
+
+// imageBytes returns the size of the level 0 tiles, or math.MaxInt64
+// on overflow.
+func (hdr *_RawHeader) imageBytes() int64 {
+	across := (int64(hdr.Width) + int64(hdr.TileWidth) - 1) / int64(hdr.TileWidth)
+	down := (int64(hdr.Height) + int64(hdr.TileHeight) - 1) / int64(hdr.TileHeight)
+	if n := across * down; n <= math.MaxInt64/hdr.tileBytes() {
+		return n * hdr.tileBytes()
+	}
+	return math.MaxInt64
+}
+
+func (p *_RawImage) initLayout() {
+	p.tileSize = image.Pt(int(p.hdr.TileWidth), int(p.hdr.TileHeight))
+	p.pixSize = ximage.SizeofPixel(int(p.hdr.Channels), reflect.Kind(p.hdr.DataType))
+	p.tileBytes = p.tileSize.X * p.tileSize.Y * p.pixSize
+
+	w, h := int(p.hdr.Width), int(p.hdr.Height)
+	offset, index := int64(p.hdr.HeaderSize), 0
+	p.levels = nil
+	for {
+		lv := _RawLevel{
+			Width:       w,
+			Height:      h,
+			TilesAcross: (w + p.tileSize.X - 1) / p.tileSize.X,
+			TilesDown:   (h + p.tileSize.Y - 1) / p.tileSize.Y,
+			Offset:      offset,
+			Index:       index,
+		}
+		p.levels = append(p.levels, lv)
+		if lv.TilesAcross == 1 && lv.TilesDown == 1 {
+			break
+		}
+		offset += int64(lv.TilesAcross*lv.TilesDown) * int64(p.tileBytes)
+		index += lv.TilesAcross * lv.TilesDown
+		w, h = maxInt(w/2, 1), maxInt(h/2, 1)
+	}
+}
+
+// imageEnd returns the minimum size of the file, the end of the image
+// or of the tile index.
+func (p *_RawImage) imageEnd() int64 {
+	if p.codec != nil {
+		return int64(p.hdr.HeaderSize) + int64(p.tileCount())*_RawTileEntrySize
+	}
+	return p.levelEnd(0)
+}
+
+func (p *_RawImage) tileCount() int {
+	lv := p.levels[len(p.levels)-1]
+	return lv.Index + lv.TilesAcross*lv.TilesDown
+}
+
+func (p *_RawImage) levelEnd(level int) int64 {
+	lv := p.levels[level]
+	return lv.Offset + int64(lv.TilesAcross*lv.TilesDown)*int64(p.tileBytes)
+}
+
+func (p *_RawImage) writeHeader() error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &p.hdr); err != nil {
+		return err
+	}
+	_, err := p.f.WriteAt(buf.Bytes(), 0)
+	return err
+}
+
+func (p *_RawImage) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.f == nil {
+		return nil
+	}
+	err := p.f.Close()
+	p.f = nil
+	return err
+}
+
+func (p *_RawImage) Width() int {
+	return int(p.hdr.Width)
+}
+func (p *_RawImage) Height() int {
+	return int(p.hdr.Height)
+}
+func (p *_RawImage) Channels() int {
+	return int(p.hdr.Channels)
+}
+func (p *_RawImage) DataType() reflect.Kind {
+	return reflect.Kind(p.hdr.DataType)
+}
+
+func (p *_RawImage) TileSize() image.Point {
+	return p.tileSize
+}
+
+func (p *_RawImage) NoData() (v float64, ok bool) {
+	return p.hdr.NoData, p.hdr.HasNoData != 0
+}
+
+// swapTile reports whether the tiles byte order is not the host's.
+func (p *_RawImage) swapTile() bool {
+	return (p.hdr.ByteOrder == _RawBigEndian) == isLittleEndian
+}
+
+func (p *_RawImage) Read(r image.Rectangle) (m image.Image, err error) {
+	return p.ReadOverview(0, r)
+}
+
+func (p *_RawImage) ReadOverview(idxOverview int, r image.Rectangle) (m image.Image, err error) {
+	if idxOverview < 0 {
+		return nil, errors.New("image/big: _RawImage.ReadOverview, invalid idxOverview!")
+	}
+	if idxOverview >= len(p.levels) {
+		if len(p.levels) == 1 {
+			return nil, ErrNoOverviewsFeature
+		}
+		return nil, ErrOverviewIndex
+	}
+	if r.Empty() {
+		return nil, errors.New("image/big: _RawImage.Read, empty rect!")
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.f == nil {
+		return nil, errors.New("image/big: _RawImage.Read, closed!")
+	}
+	if idxOverview > int(p.hdr.Overviews) {
+		return nil, ErrNoOverviews
+	}
+	if m, err = p.readRect(idxOverview, r); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// readRect reads r of the level, the result bounds is (0,0)-(r.Dx(),r.Dy()),
+// the pixels outside the level are zero.
+func (p *_RawImage) readRect(level int, r image.Rectangle) (*ximage.MemPImage, error) {
+	m := ximage.NewMemPImage(image.Rect(0, 0, r.Dx(), r.Dy()), p.Channels(), p.DataType())
+
+	lv := p.levels[level]
+	rr := r.Intersect(image.Rect(0, 0, lv.Width, lv.Height))
+	if rr.Empty() {
+		return m, nil
+	}
+
+	buf := make([]byte, p.tileBytes)
+	err := p.forEachTile(rr, func(col, row int, tb, z image.Rectangle) error {
+		if err := p.readTile(level, col, row, buf); err != nil {
+			return err
+		}
+		n := z.Dx() * p.pixSize
+		for y := z.Min.Y; y < z.Max.Y; y++ {
+			copy(
+				m.XPix[m.PixOffset(z.Min.X-r.Min.X, y-r.Min.Y):][:n],
+				buf[((y-tb.Min.Y)*p.tileSize.X+(z.Min.X-tb.Min.X))*p.pixSize:][:n],
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (p *_RawImage) Write(r image.Rectangle, m image.Image) error {
+	src, ok := ximage.AsMemPImage(m)
+	if !ok {
+		src = ximage.NewMemPImageFrom(m)
+	}
+	if src.XChannels != p.Channels() || src.XDataType != p.DataType() {
+		return fmt.Errorf("image/big: _RawImage.Write, pixel type mismatch: (%d, %v) != (%d, %v)",
+			src.XChannels, src.XDataType, p.Channels(), p.DataType(),
+		)
+	}
+	if r.Empty() || !r.In(image.Rect(0, 0, p.Width(), p.Height())) {
+		return fmt.Errorf("image/big: _RawImage.Write, invalid rect: %v", r)
+	}
+	if sb := src.Bounds(); sb.Dx() < r.Dx() || sb.Dy() < r.Dy() {
+		return fmt.Errorf("image/big: _RawImage.Write, image too small: %v < %v", sb.Size(), r.Size())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.f == nil {
+		return errors.New("image/big: _RawImage.Write, closed!")
+	}
+	if p.readOnly {
+		return errors.New("image/big: _RawImage.Write, read only!")
+	}
+
+	// the overviews are out of date
+	if p.hdr.Overviews != 0 {
+		p.hdr.Overviews = 0
+		if err := p.writeHeader(); err != nil {
+			return err
+		}
+	}
+	return p.writeRect(0, r, src)
+}
+
+// writeRect writes src (from its Bounds().Min) to r of the level.
+func (p *_RawImage) writeRect(level int, r image.Rectangle, src *ximage.MemPImage) error {
+	lv := p.levels[level]
+	lb := image.Rect(0, 0, lv.Width, lv.Height)
+	sp := src.Bounds().Min
+
+	buf := make([]byte, p.tileBytes)
+	return p.forEachTile(r, func(col, row int, tb, z image.Rectangle) error {
+		if z != tb.Intersect(lb) {
+			if err := p.readTile(level, col, row, buf); err != nil {
+				return err
+			}
+		} else if z != tb {
+			for i := range buf {
+				buf[i] = 0 // padding of the edge tile
+			}
+		}
+		n := z.Dx() * p.pixSize
+		for y := z.Min.Y; y < z.Max.Y; y++ {
+			copy(
+				buf[((y-tb.Min.Y)*p.tileSize.X+(z.Min.X-tb.Min.X))*p.pixSize:][:n],
+				src.XPix[src.PixOffset(sp.X+z.Min.X-r.Min.X, sp.Y+y-r.Min.Y):][:n],
+			)
+		}
+		return p.writeTile(level, col, row, buf)
+	})
+}
+
+// forEachTile calls fn with the tile bounds tb and the intersection z of r.
+func (p *_RawImage) forEachTile(r image.Rectangle, fn func(col, row int, tb, z image.Rectangle) error) error {
+	tw, th := p.tileSize.X, p.tileSize.Y
+	for row := r.Min.Y / th; row < (r.Max.Y+th-1)/th; row++ {
+		for col := r.Min.X / tw; col < (r.Max.X+tw-1)/tw; col++ {
+			tb := image.Rect(col*tw, row*th, col*tw+tw, row*th+th)
+			if err := fn(col, row, tb, tb.Intersect(r)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *_RawImage) tileOffset(level, col, row int) int64 {
+	lv := p.levels[level]
+	return lv.Offset + int64(row*lv.TilesAcross+col)*int64(p.tileBytes)
+}
+
+func (p *_RawImage) readTile(level, col, row int, buf []byte) error {
+	if p.codec != nil {
+		return p.readCompressedTile(level, col, row, buf)
+	}
+	n, err := p.f.ReadAt(buf, p.tileOffset(level, col, row))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	// missing tail of a truncated file
+	for i := n; i < len(buf); i++ {
+		buf[i] = 0
+	}
+	if p.swapTile() {
+		ximage.PixSlice(buf).SwapEndian(p.DataType())
+	}
+	return nil
+}
+
+func (p *_RawImage) writeTile(level, col, row int, buf []byte) error {
+	if p.codec != nil {
+		return p.writeCompressedTile(level, col, row, buf)
+	}
+	if p.swapTile() {
+		buf = append([]byte(nil), buf...)
+		ximage.PixSlice(buf).SwapEndian(p.DataType())
+	}
+	_, err := p.f.WriteAt(buf, p.tileOffset(level, col, row))
+	return err
+}
@@ -0,0 +1,211 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+
+	ximage "github.com/chai2010/image"
+)
+
+const (
+	_RawTileEntrySize = 16
+)
+
+// _RawTileEntry is the place of a compressed tile.
+type _RawTileEntry struct {
+	Offset int64
+	Size   int64
+}
+
+// _RawTileError is a tile which can not be decoded.
+type _RawTileError struct {
+	Level, Col, Row int
+	Err             error
+}
+
+func (e *_RawTileError) Error() string {
+	return fmt.Sprintf("image/big: raw, tile %d (%d,%d): %v", e.Level, e.Col, e.Row, e.Err)
+}
+
+func isTileCodec(id uint8) bool {
+	_, ok := lookupTileCodecByID(id)
+	return ok
+}
+
+func isIntegerKind(dataType reflect.Kind) bool {
+	_, _, ok := kindRange(dataType)
+	return ok
+}
+
+// readIndex reads the tile index, the caller checks it is in the file.
+func (p *_RawImage) readIndex(size int64) error {
+	p.index = make([]_RawTileEntry, p.tileCount())
+	r := io.NewSectionReader(p.f, int64(p.hdr.HeaderSize), int64(len(p.index))*_RawTileEntrySize)
+	if err := binary.Read(r, binary.LittleEndian, p.index); err != nil {
+		return fmt.Errorf("image/big: raw, read tile index: %v", err)
+	}
+	p.end = size
+	return nil
+}
+
+func (p *_RawImage) tileIndex(level, col, row int) int {
+	lv := p.levels[level]
+	return lv.Index + row*lv.TilesAcross + col
+}
+
+// tileMissing reports whether the tile is past the end of file.
+func (p *_RawImage) tileMissing(level, col, row int, size int64) bool {
+	if p.codec != nil {
+		e := p.index[p.tileIndex(level, col, row)]
+		return e.Size > 0 && e.Offset+e.Size > size
+	}
+	return p.tileOffset(level, col, row)+int64(p.tileBytes) > size
+}
+
+func (p *_RawImage) readCompressedTile(level, col, row int, buf []byte) error {
+	e := p.index[p.tileIndex(level, col, row)]
+	if e.Size == 0 {
+		for i := range buf {
+			buf[i] = 0
+		}
+		return nil
+	}
+	if e.Offset < p.imageEnd() || e.Size > int64(len(buf))*2+1024 {
+		return &_RawTileError{level, col, row, fmt.Errorf("bad index: %d, %d", e.Offset, e.Size)}
+	}
+
+	data := make([]byte, e.Size)
+	if _, err := p.f.ReadAt(data, e.Offset); err != nil {
+		return &_RawTileError{level, col, row, err}
+	}
+	if err := p.codec.Decode(buf, data); err != nil {
+		return &_RawTileError{level, col, row, err}
+	}
+	if p.swapTile() {
+		ximage.PixSlice(buf).SwapEndian(p.DataType())
+	}
+	if p.hdr.Predictor == _RawPredictorHorizontal {
+		p.predictTile(buf, false)
+	}
+	return nil
+}
+
+// writeCompressedTile appends the tile to the file, then updates its
+// index entry.
+func (p *_RawImage) writeCompressedTile(level, col, row int, buf []byte) error {
+	buf = append([]byte(nil), buf...)
+	if p.hdr.Predictor == _RawPredictorHorizontal {
+		p.predictTile(buf, true)
+	}
+	if p.swapTile() {
+		ximage.PixSlice(buf).SwapEndian(p.DataType())
+	}
+	data, err := p.codec.Encode(buf)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("image/big: raw, empty compressed tile")
+	}
+
+	e := _RawTileEntry{Offset: p.end, Size: int64(len(data))}
+	if _, err = p.f.WriteAt(data, e.Offset); err != nil {
+		return err
+	}
+	p.end += e.Size
+
+	var w bytes.Buffer
+	binary.Write(&w, binary.LittleEndian, &e)
+	i := p.tileIndex(level, col, row)
+	if _, err = p.f.WriteAt(w.Bytes(), int64(p.hdr.HeaderSize)+int64(i)*_RawTileEntrySize); err != nil {
+		return err
+	}
+	p.index[i] = e
+	return nil
+}
+
+// predictTile replaces every value of the tile rows by its difference
+// with the value of the left pixel, or undoes it.
+func (p *_RawImage) predictTile(buf []byte, encode bool) {
+	ch, w := p.Channels(), p.tileSize.X
+	stride := ch * w
+	pix := ximage.PixSlice(buf)
+
+	switch ximage.SizeofKind(p.DataType()) {
+	case 1:
+		v := pix.Uint8s()
+		for y := 0; y < len(v); y += stride {
+			predictRow8(v[y:y+stride], ch, encode)
+		}
+	case 2:
+		v := pix.Uint16s()
+		for y := 0; y < len(v); y += stride {
+			predictRow16(v[y:y+stride], ch, encode)
+		}
+	case 4:
+		v := pix.Uint32s()
+		for y := 0; y < len(v); y += stride {
+			predictRow32(v[y:y+stride], ch, encode)
+		}
+	case 8:
+		v := pix.Uint64s()
+		for y := 0; y < len(v); y += stride {
+			predictRow64(v[y:y+stride], ch, encode)
+		}
+	}
+}
+
+func predictRow8(v []uint8, ch int, encode bool) {
+	if encode {
+		for i := len(v) - 1; i >= ch; i-- {
+			v[i] -= v[i-ch]
+		}
+		return
+	}
+	for i := ch; i < len(v); i++ {
+		v[i] += v[i-ch]
+	}
+}
+
+func predictRow16(v []uint16, ch int, encode bool) {
+	if encode {
+		for i := len(v) - 1; i >= ch; i-- {
+			v[i] -= v[i-ch]
+		}
+		return
+	}
+	for i := ch; i < len(v); i++ {
+		v[i] += v[i-ch]
+	}
+}
+
+func predictRow32(v []uint32, ch int, encode bool) {
+	if encode {
+		for i := len(v) - 1; i >= ch; i-- {
+			v[i] -= v[i-ch]
+		}
+		return
+	}
+	for i := ch; i < len(v); i++ {
+		v[i] += v[i-ch]
+	}
+}
+
+func predictRow64(v []uint64, ch int, encode bool) {
+	if encode {
+		for i := len(v) - 1; i >= ch; i-- {
+			v[i] -= v[i-ch]
+		}
+		return
+	}
+	for i := ch; i < len(v); i++ {
+		v[i] += v[i-ch]
+	}
+}
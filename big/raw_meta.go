@@ -0,0 +1,113 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	_RawMaxMetaSize = 16 << 20
+)
+
+// _RawMeta is the JSON metadata of the raw file.
+type _RawMeta struct {
+	Geo      *GeoReference `json:"geo,omitempty"`
+	Metadata *Metadata     `json:"metadata,omitempty"`
+}
+
+func (p *_RawImage) readMeta() error {
+	if p.hdr.MetaSize == 0 {
+		return nil
+	}
+	data := make([]byte, p.hdr.MetaSize)
+	if _, err := p.f.ReadAt(data, p.hdr.MetaOffset); err != nil {
+		return fmt.Errorf("image/big: raw, read metadata: %v", err)
+	}
+	if err := json.Unmarshal(data, &p.meta); err != nil {
+		return fmt.Errorf("image/big: raw, bad metadata: %v", err)
+	}
+	return nil
+}
+
+// writeMeta writes p.meta after the last level, or at the end of a
+// compressed file, and updates the header. The caller holds the write lock.
+func (p *_RawImage) writeMeta() error {
+	if p.f == nil {
+		return errors.New("image/big: _RawImage.writeMeta, closed!")
+	}
+	if p.readOnly {
+		return errors.New("image/big: _RawImage.writeMeta, read only!")
+	}
+
+	data, err := json.Marshal(&p.meta)
+	if err != nil {
+		return err
+	}
+	if len(data) > _RawMaxMetaSize {
+		return fmt.Errorf("image/big: raw, metadata too big: %d", len(data))
+	}
+	if p.codec != nil {
+		offset := p.end
+		if _, err = p.f.WriteAt(data, offset); err != nil {
+			return err
+		}
+		p.end += int64(len(data))
+		p.hdr.MetaOffset, p.hdr.MetaSize = offset, int64(len(data))
+		return p.writeHeader()
+	}
+
+	offset := p.levelEnd(len(p.levels) - 1)
+	if _, err = p.f.WriteAt(data, offset); err != nil {
+		return err
+	}
+	if err = p.f.Truncate(offset + int64(len(data))); err != nil {
+		return err
+	}
+	p.hdr.MetaOffset, p.hdr.MetaSize = offset, int64(len(data))
+	return p.writeHeader()
+}
+
+func (p *_RawImage) GeoReference() (g *GeoReference, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.meta.Geo == nil {
+		return nil, false
+	}
+	return p.meta.Geo.Clone(), true
+}
+
+func (p *_RawImage) SetGeoReference(g *GeoReference) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.meta.Geo = g.Clone()
+	return p.writeMeta()
+}
+
+func (p *_RawImage) Metadata() (md *Metadata, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.meta.Metadata == nil {
+		return nil, false
+	}
+	return p.meta.Metadata.Clone(), true
+}
+
+func (p *_RawImage) SetMetadata(md *Metadata) error {
+	if md != nil && len(md.Bands) > p.Channels() {
+		return fmt.Errorf("image/big: _RawImage.SetMetadata, too many bands: %d > %d", len(md.Bands), p.Channels())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.meta.Metadata = md.Clone()
+	return p.writeMeta()
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"errors"
+	"image"
+
+	ximage "github.com/chai2010/image"
+	xdraw "github.com/chai2010/image/draw"
+)
+
+func (p *_RawImage) HasOverviews() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.hdr.Overviews > 0
+}
+func (p *_RawImage) HasOverviewsFeature() bool {
+	return len(p.levels) > 1
+}
+
+// BuildOverviews rebuilds all the overview levels from the image.
+func (p *_RawImage) BuildOverviews() error {
+	return p.BuildOverviewsContext(context.Background(), nil)
+}
+
+func (p *_RawImage) BuildOverviewsIfNotExists() error {
+	return p.BuildOverviewsIfNotExistsContext(context.Background(), nil)
+}
+
+func (p *_RawImage) BuildOverviewsContext(ctx context.Context, progress ProgressFunc) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.checkBuildOverviews(); err != nil {
+		return err
+	}
+	return p.buildOverviews(ctx, progress)
+}
+
+func (p *_RawImage) BuildOverviewsIfNotExistsContext(ctx context.Context, progress ProgressFunc) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.checkBuildOverviews(); err != nil {
+		return err
+	}
+	if p.hdr.Overviews > 0 {
+		return nil
+	}
+	return p.buildOverviews(ctx, progress)
+}
+
+func (p *_RawImage) checkBuildOverviews() error {
+	if p.f == nil {
+		return errors.New("image/big: _RawImage.BuildOverviews, closed!")
+	}
+	if len(p.levels) < 2 {
+		return ErrNoOverviewsFeature
+	}
+	if p.readOnly {
+		return errors.New("image/big: _RawImage.BuildOverviews, read only!")
+	}
+	return nil
+}
+
+// buildOverviews marks the overviews as not built until all the levels
+// are written, so a cancelled or failed build leaves no overviews.
+func (p *_RawImage) buildOverviews(ctx context.Context, progress ProgressFunc) error {
+	if p.hdr.Overviews != 0 {
+		p.hdr.Overviews = 0
+		if err := p.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	state := OverviewsProgress{Levels: len(p.levels) - 1}
+	for level := 1; level < len(p.levels); level++ {
+		state.TotalTiles += p.levels[level].TilesAcross * p.levels[level].TilesDown
+	}
+	for level := 1; level < len(p.levels); level++ {
+		lv := p.levels[level]
+		state.Level = level
+		err := p.forEachTile(image.Rect(0, 0, lv.Width, lv.Height), func(col, row int, tb, z image.Rectangle) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := p.buildOverviewTile(level, z); err != nil {
+				return err
+			}
+			state.Tiles++
+			if progress != nil {
+				progress(state)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	p.hdr.Overviews = int32(len(p.levels) - 1)
+	return p.writeHeader()
+}
+
+// buildOverviewTile reduces the 2x rect of the parent level into r of the level.
+func (p *_RawImage) buildOverviewTile(level int, r image.Rectangle) error {
+	dst, err := p.reduceRect(level, r)
+	if err != nil {
+		return err
+	}
+	return p.writeRect(level, r, dst)
+}
+
+// reduceRect returns r of the level reduced from the parent level. The
+// 2x rect is clamped to the parent, a parent of 1 pixel wide or tall is
+// not reduced in that direction.
+func (p *_RawImage) reduceRect(level int, r image.Rectangle) (*ximage.MemPImage, error) {
+	parent := image.Rect(0, 0, p.levels[level-1].Width, p.levels[level-1].Height)
+	sr := image.Rect(r.Min.X*2, r.Min.Y*2, r.Max.X*2, r.Max.Y*2).Intersect(parent)
+	src, err := p.readRect(level-1, sr)
+	if err != nil {
+		return nil, err
+	}
+	dst := ximage.NewMemPImage(image.Rect(0, 0, r.Dx(), r.Dy()), p.Channels(), p.DataType())
+	xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, src.Bounds())
+	return dst, nil
+}
@@ -0,0 +1,346 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+	xdraw "github.com/chai2010/image/draw"
+)
+
+func tTempDir(t *testing.T) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "image-big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func tNewPattern(r image.Rectangle, channels int, dataType reflect.Kind) *ximage.MemPImage {
+	m := ximage.NewMemPImage(r, channels, dataType)
+	for i := range m.XPix {
+		m.XPix[i] = byte(i*7 + i/13)
+	}
+	return m
+}
+
+func tEqualRect(t *testing.T, m image.Image, src *ximage.MemPImage, r image.Rectangle) {
+	p, ok := ximage.AsMemPImage(m)
+	if !ok {
+		t.Fatalf("%v: not MemP: %T", r, m)
+	}
+	if b := p.Bounds(); b != image.Rect(0, 0, r.Dx(), r.Dy()) {
+		t.Fatalf("%v: bad bounds: %v", r, b)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if a, b := p.PixelAt(x-r.Min.X, y-r.Min.Y), src.PixelAt(x, y); !bytes.Equal(a, b) {
+				t.Fatalf("%v: (%d,%d): %v != %v", r, x, y, a, b)
+			}
+		}
+	}
+}
+
+func TestRawImage(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	src := tNewPattern(image.Rect(0, 0, 600, 300), 3, reflect.Uint16)
+
+	w, err := CreateImageWriter("raw", filename, 600, 300, 3, reflect.Uint16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 600, 100),
+		image.Rect(0, 100, 300, 300),
+		image.Rect(300, 100, 600, 300),
+	} {
+		if err := w.Write(r, src.SubImage(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write(image.Rect(0, 0, 10, 10), image.NewRGBA(image.Rect(0, 0, 10, 10))); err == nil {
+		t.Fatal("expect pixel type error")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.Width() != 600 || r.Height() != 300 || r.Channels() != 3 || r.DataType() != reflect.Uint16 {
+		t.Fatalf("bad image: %dx%d, %d, %v", r.Width(), r.Height(), r.Channels(), r.DataType())
+	}
+	for _, rect := range []image.Rectangle{
+		image.Rect(0, 0, 600, 300),
+		image.Rect(250, 250, 260, 300),
+		image.Rect(1, 2, 3, 4),
+	} {
+		m, err := r.Read(rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, m, src, rect)
+	}
+}
+
+func TestOpenImageReader_format(t *testing.T) {
+	_, err := OpenImageReader("../testdata/lena.png")
+	if !errors.Is(err, ErrFormat) {
+		t.Fatalf("expect ErrFormat, got %v", err)
+	}
+	if e, ok := err.(*OpenError); !ok || len(e.Errors) != len(ImageReaderDrivers()) {
+		t.Fatalf("expect *OpenError for each driver, got %v", err)
+	}
+	if _, err := OpenImageReaderWith("raw", "../testdata/lena.png"); err != ErrFormat {
+		t.Fatalf("expect ErrFormat, got %v", err)
+	}
+	if _, err := OpenImageReaderWith("unknown", "../testdata/lena.png"); err == nil {
+		t.Fatal("expect unknown driver error")
+	}
+}
+
+func TestOpenImageReader_badHeader(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	newHeader := func() _RawHeader {
+		hdr := _RawHeader{
+			HeaderSize: _RawHeaderSize,
+			Version:    _RawVersion,
+			Width:      100,
+			Height:     100,
+			Channels:   1,
+			DataType:   int32(reflect.Uint8),
+			TileWidth:  16,
+			TileHeight: 16,
+		}
+		copy(hdr.Magic[:], _RawMagic)
+		return hdr
+	}
+
+	// a header only file of 256 bytes
+	for i, fn := range []func(hdr *_RawHeader){
+		func(hdr *_RawHeader) { hdr.Channels = 1 << 30 },
+		func(hdr *_RawHeader) { hdr.TileWidth, hdr.TileHeight = 1<<30, 1<<30 },
+		func(hdr *_RawHeader) { hdr.TileWidth, hdr.TileHeight, hdr.Channels = 1<<16, 1<<16, 1<<12 },
+		func(hdr *_RawHeader) { hdr.Width, hdr.Height, hdr.TileWidth, hdr.TileHeight = 1<<31-1, 1<<31-1, 1, 1 },
+		func(hdr *_RawHeader) { hdr.TileWidth, hdr.TileHeight = 1<<12, 1<<12 },
+		func(hdr *_RawHeader) {},
+		func(hdr *_RawHeader) { hdr.Compress = 1 },
+		func(hdr *_RawHeader) {
+			hdr.Width, hdr.Height, hdr.TileWidth, hdr.TileHeight, hdr.Compress = 1<<20, 1<<20, 1, 1, 1
+		},
+	} {
+		hdr := newHeader()
+		fn(&hdr)
+
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, &hdr)
+		filename := filepath.Join(dir, "a.raw")
+		if err := ioutil.WriteFile(filename, buf.Bytes(), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if r, err := OpenImageReaderWith("raw", filename); err == nil {
+			r.Close()
+			t.Fatalf("%d: expect error", i)
+		}
+	}
+
+	if _, err := CreateImageWriterWithOptions("raw", filepath.Join(dir, "b.raw"), 10, 10, 1<<13, reflect.Uint8, nil); err == nil {
+		t.Fatal("expect channels error")
+	}
+}
+
+func TestImageReaderDrivers(t *testing.T) {
+	names := ImageReaderDrivers()
+	found := false
+	for _, name := range names {
+		found = found || name == RawDriverName
+	}
+	if !found {
+		t.Fatalf("bad drivers: %v", names)
+	}
+
+	RegisterImageReader(RawDriverName, openRawImageReader) // replace
+	if v := ImageReaderDrivers(); !reflect.DeepEqual(v, names) {
+		t.Fatalf("bad drivers: %v != %v", v, names)
+	}
+}
+
+func TestRawImage_overviews(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	src := tNewPattern(image.Rect(0, 0, 1000, 700), 1, reflect.Uint8)
+
+	w, err := CreateImageWriter("raw", filename, 1000, 700, 1, reflect.Uint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if !r.HasOverviewsFeature() || r.HasOverviews() {
+		t.Fatalf("bad overviews state: %v, %v", r.HasOverviewsFeature(), r.HasOverviews())
+	}
+	if _, err := r.ReadOverview(1, image.Rect(0, 0, 10, 10)); err != ErrNoOverviews {
+		t.Fatalf("expect ErrNoOverviews, got %v", err)
+	}
+	if err := r.BuildOverviewsIfNotExists(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.HasOverviews() {
+		t.Fatal("expect overviews")
+	}
+
+	// 1000x700 => 500x350 => 250x175
+	want := src.Bounds()
+	for level := 0; level < 3; level++ {
+		m, err := r.ReadOverview(level, want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, m, src, want)
+		src = xdraw.MakePyrDown(src, xdraw.ApproxBiLinear).(*ximage.MemPImage)
+		want = src.Bounds()
+	}
+	if _, err := r.ReadOverview(3, image.Rect(0, 0, 10, 10)); err == nil {
+		t.Fatal("expect invalid idxOverview error")
+	}
+}
+
+func TestRawImage_overviewsEdge(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	src := ximage.NewMemPImage(image.Rect(0, 0, 1, 64), 1, reflect.Uint8)
+	for i := range src.XPix {
+		src.XPix[i] = 200
+	}
+
+	w, err := CreateImageWriterWithOptions("raw", filename, 1, 64, 1, reflect.Uint8, &CreateOptions{
+		TileSize: image.Pt(8, 8),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1x64 => 1x32 => 1x16 => 1x8, the column outside is not averaged in
+	for level, h := 1, 32; level < 4; level, h = level+1, h/2 {
+		m, err := r.ReadOverview(level, image.Rect(0, 0, 1, h))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range m.(*ximage.MemPImage).XPix {
+			if v != 200 {
+				t.Fatalf("level %d: pix[%d]: %d != 200", level, i, v)
+			}
+		}
+	}
+}
+
+func TestCreateImageWriterWithOptions(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	src := tNewPattern(image.Rect(0, 0, 150, 70), 2, reflect.Uint16)
+	noData := -1.5
+
+	w, err := CreateImageWriterWithOptions("raw", filename, 150, 70, 2, reflect.Uint16, &CreateOptions{
+		TileSize:         image.Pt(32, 16),
+		ByteOrder:        binary.BigEndian,
+		NoData:           &noData,
+		ReserveOverviews: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 150x70 in 32x16 tiles: 5x5, 3x3, 2x2, 1x1
+	if fi, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	} else if want := int64(_RawHeaderSize + (25+9+4+1)*32*16*4); fi.Size() != want {
+		t.Fatalf("bad file size: %d != %d", fi.Size(), want)
+	}
+
+	// big endian tiles
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := binary.BigEndian.Uint16(data[_RawHeaderSize:]), src.XPix[0:2]; a != uint16(b[0])|uint16(b[1])<<8 {
+		t.Fatalf("not big endian: %x, %v", a, b)
+	}
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if v, ok := r.(NoDataImage).NoData(); !ok || v != noData {
+		t.Fatalf("bad nodata: %v, %v", v, ok)
+	}
+	m, err := r.Read(image.Rect(10, 5, 140, 66))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, m, src, image.Rect(10, 5, 140, 66))
+
+	for _, opt := range []*CreateOptions{
+		{Compression: "jpeg"},
+		{TileSize: image.Pt(-1, 8)},
+	} {
+		if _, err := CreateImageWriterWithOptions("raw", filename, 10, 10, 1, reflect.Uint8, opt); err == nil {
+			t.Fatalf("%+v: expect error", opt)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+)
+
+var (
+	_ Verifier = (*_RawImage)(nil)
+)
+
+func (p *_RawImage) Verify(ctx context.Context, opt *VerifyOptions) (*VerifyReport, error) {
+	if opt == nil {
+		opt = new(VerifyOptions)
+	}
+	if opt.Repair {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+	} else {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+	}
+
+	if p.f == nil {
+		return nil, errors.New("image/big: _RawImage.Verify, closed!")
+	}
+	if opt.Repair && p.readOnly {
+		return nil, errors.New("image/big: _RawImage.Verify, read only!")
+	}
+	fi, err := p.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &VerifyReport{Overviews: p.hdr.Overviews > 0}
+	p.verifyHeader(rep, fi.Size())
+
+	// the missing tiles of the image can not be repaired
+	lv := p.levels[0]
+	for i := 0; i < lv.TilesAcross*lv.TilesDown; i++ {
+		col, row := i%lv.TilesAcross, i/lv.TilesAcross
+		if p.tileMissing(0, col, row, fi.Size()) {
+			rep.Problems = append(rep.Problems, VerifyProblem{
+				Level: 0, Tile: image.Pt(col, row), Message: "missing tile",
+			})
+		}
+	}
+
+	if len(p.levels) < 2 || (p.hdr.Overviews == 0 && !(opt.Repair && opt.Full)) {
+		return rep, nil
+	}
+	if err := p.verifyOverviews(ctx, opt, rep, fi.Size()); err != nil {
+		return nil, err
+	}
+
+	// a completed interrupted build
+	if opt.Repair && p.hdr.Overviews == 0 && rep.OK() {
+		p.hdr.Overviews = int32(len(p.levels) - 1)
+		if err := p.writeHeader(); err != nil {
+			return nil, err
+		}
+		rep.Overviews = true
+	}
+	return rep, nil
+}
+
+func (p *_RawImage) verifyHeader(rep *VerifyReport, size int64) {
+	problem := func(format string, a ...interface{}) {
+		rep.Problems = append(rep.Problems, VerifyProblem{Level: -1, Message: fmt.Sprintf(format, a...)})
+	}
+
+	last := len(p.levels) - 1
+	if p.hdr.Overviews != 0 && int(p.hdr.Overviews) != last {
+		problem("bad overviews: %d, expect %d", p.hdr.Overviews, last)
+	}
+	if end := p.imageEnd(); size < end {
+		problem("file too small: %d < %d", size, end)
+	}
+	if p.hdr.MetaSize > 0 {
+		end := p.imageEnd()
+		if p.codec == nil {
+			end = p.levelEnd(last)
+		}
+		if p.hdr.MetaOffset < end {
+			problem("metadata overlaps the tiles: %d < %d", p.hdr.MetaOffset, end)
+		}
+		if end := p.hdr.MetaOffset + p.hdr.MetaSize; end > size {
+			problem("metadata past the end of file: %d > %d", end, size)
+		}
+	}
+}
+
+// verifyOverviews checks the overview tiles against the reduced parent
+// tiles. The children of a repaired tile are checked too.
+func (p *_RawImage) verifyOverviews(ctx context.Context, opt *VerifyOptions, rep *VerifyReport, size int64) error {
+	samples := opt.Samples
+	if samples == 0 {
+		samples = DefaultVerifySamples
+	}
+
+	var dirty map[image.Point]bool // the tiles with a repaired parent
+	for level := 1; level < len(p.levels); level++ {
+		lv := p.levels[level]
+		lb := image.Rect(0, 0, lv.Width, lv.Height)
+
+		tiles := make(map[image.Point]bool)
+		total, n := lv.TilesAcross*lv.TilesDown, samples
+		if opt.Full {
+			n = total
+		}
+		for _, i := range verifySamples(total, n) {
+			tiles[image.Pt(i%lv.TilesAcross, i/lv.TilesAcross)] = true
+		}
+		for t := range dirty {
+			tiles[t] = true
+		}
+
+		next := make(map[image.Point]bool)
+		for row := 0; row < lv.TilesDown; row++ {
+			for col := 0; col < lv.TilesAcross; col++ {
+				t := image.Pt(col, row)
+				if !tiles[t] {
+					continue
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				rep.TilesChecked++
+
+				tw, th := p.tileSize.X, p.tileSize.Y
+				z := image.Rect(col*tw, row*th, col*tw+tw, row*th+th).Intersect(lb)
+
+				msg, repairable := "", true
+				if p.tileMissing(level, col, row, size) {
+					msg = "missing tile"
+				} else if ok, err := p.verifyOverviewTile(level, z); err != nil {
+					e, isTileErr := err.(*_RawTileError)
+					if !isTileErr {
+						return err
+					}
+					msg, repairable = e.Error(), e.Level == level
+				} else if !ok {
+					msg = "overview mismatch"
+				}
+				if msg == "" {
+					continue
+				}
+
+				prob := VerifyProblem{Level: level, Tile: t, Message: msg}
+				if opt.Repair && repairable {
+					if err := p.buildOverviewTile(level, z); err != nil {
+						return err
+					}
+					prob.Repaired = true
+					p.markChildTiles(level, z, next)
+				}
+				rep.Problems = append(rep.Problems, prob)
+			}
+		}
+		dirty = next
+	}
+	return nil
+}
+
+func (p *_RawImage) verifyOverviewTile(level int, r image.Rectangle) (ok bool, err error) {
+	want, err := p.reduceRect(level, r)
+	if err != nil {
+		return false, err
+	}
+	got, err := p.readRect(level, r)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(got.XPix, want.XPix), nil
+}
+
+// markChildTiles adds the tiles of the next level reduced from r of the level.
+func (p *_RawImage) markChildTiles(level int, r image.Rectangle, tiles map[image.Point]bool) {
+	if level+1 >= len(p.levels) {
+		return
+	}
+	lv := p.levels[level+1]
+	cr := image.Rect(r.Min.X/2, r.Min.Y/2, (r.Max.X+1)/2, (r.Max.Y+1)/2)
+	cr = cr.Intersect(image.Rect(0, 0, lv.Width, lv.Height))
+	p.forEachTile(cr, func(col, row int, tb, z image.Rectangle) error {
+		tiles[image.Pt(col, row)] = true
+		return nil
+	})
+}
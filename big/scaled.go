@@ -0,0 +1,90 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"errors"
+	"image"
+
+	ximage "github.com/chai2010/image"
+	xdraw "github.com/chai2010/image/draw"
+)
+
+// ReadScaled reads rect of the image resampled to size with scaler, the
+// result bounds is (0,0)-size. The source is the smallest overview which
+// is not smaller than size, if the overviews are not built the image is
+// used. The overview pixels are read to cover rect, only the ones of
+// rect, rounded to the nearest, are scaled. A nil scaler means
+// xdraw.ApproxBiLinear.
+func ReadScaled(r ImageReader, rect image.Rectangle, size image.Point, scaler xdraw.Scaler) (m *ximage.MemPImage, err error) {
+	if rect.Empty() {
+		return nil, errors.New("image/big: ReadScaled, empty rect!")
+	}
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, errors.New("image/big: ReadScaled, invalid size!")
+	}
+	if scaler == nil {
+		scaler = xdraw.ApproxBiLinear
+	}
+
+	// level i is reduced by 1<<i
+	level := 0
+	for rect.Dx()>>uint(level+1) >= size.X && rect.Dy()>>uint(level+1) >= size.Y {
+		level++
+	}
+
+	var src image.Image
+	var sr image.Rectangle
+	for ; level >= 0; level-- {
+		sr = scaledRect(rect, level)
+		if level == 0 {
+			src, err = r.Read(sr)
+		} else {
+			src, err = r.ReadOverview(level, sr)
+		}
+		switch err {
+		case nil:
+		case ErrNoOverviews, ErrNoOverviewsFeature, ErrOverviewIndex:
+			if level > 0 {
+				continue
+			}
+			fallthrough
+		default:
+			return nil, err
+		}
+		break
+	}
+
+	// only the part of rect is scaled, the read result starts at (0,0)
+	cr := roundedRect(rect, level).Sub(sr.Min).Add(src.Bounds().Min)
+	m = ximage.NewMemPImage(image.Rect(0, 0, size.X, size.Y), r.Channels(), r.DataType())
+	scaler.Scale(m, m.Bounds(), src, cr)
+	return m, nil
+}
+
+// roundedRect returns r in the level, rounded to the nearest level pixel.
+// It is inside scaledRect(r, level).
+func roundedRect(r image.Rectangle, level int) image.Rectangle {
+	if level == 0 {
+		return r
+	}
+	d := 1 << uint(level)
+	return image.Rect(
+		floorDiv(r.Min.X+d/2, d), floorDiv(r.Min.Y+d/2, d),
+		floorDiv(r.Max.X+d/2, d), floorDiv(r.Max.Y+d/2, d),
+	)
+}
+
+// scaledRect returns the level rectangle which covers r.
+func scaledRect(r image.Rectangle, level int) image.Rectangle {
+	if level == 0 {
+		return r
+	}
+	d := 1 << uint(level)
+	return image.Rect(
+		floorDiv(r.Min.X, d), floorDiv(r.Min.Y, d),
+		floorDiv(r.Max.X+d-1, d), floorDiv(r.Max.Y+d-1, d),
+	)
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"image"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+	xdraw "github.com/chai2010/image/draw"
+)
+
+// tLevelImageReader records the overview levels read.
+type tLevelImageReader struct {
+	ImageReader
+	levels []int
+}
+
+func (p *tLevelImageReader) Read(r image.Rectangle) (image.Image, error) {
+	p.levels = append(p.levels, 0)
+	return p.ImageReader.Read(r)
+}
+
+func (p *tLevelImageReader) ReadOverview(idxOverview int, r image.Rectangle) (image.Image, error) {
+	p.levels = append(p.levels, idxOverview)
+	return p.ImageReader.ReadOverview(idxOverview, r)
+}
+
+func TestReadScaled(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	src := tNewPattern(image.Rect(0, 0, 256, 256), 1, reflect.Uint8)
+	w, err := CreateImageWriterWithOptions("raw", filename, 256, 256, 1, reflect.Uint8, &CreateOptions{
+		TileSize: image.Pt(32, 32),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	r0, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r0.Close()
+	r := &tLevelImageReader{ImageReader: r0}
+
+	// no overviews, level 2 falls back to the image
+	m, err := ReadScaled(r, image.Rect(0, 0, 256, 256), image.Pt(60, 60), xdraw.NearestNeighbor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != image.Rect(0, 0, 60, 60) {
+		t.Fatalf("bad bounds: %v", m.Bounds())
+	}
+	if !reflect.DeepEqual(r.levels, []int{2, 1, 0}) {
+		t.Fatalf("bad levels: %v", r.levels)
+	}
+
+	if err := r0.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		rect  image.Rectangle
+		size  image.Point
+		level int
+	}{
+		{image.Rect(0, 0, 256, 256), image.Pt(64, 64), 2},
+		{image.Rect(0, 0, 256, 256), image.Pt(65, 64), 1},
+		{image.Rect(0, 0, 256, 256), image.Pt(300, 300), 0},
+		{image.Rect(64, 0, 128, 32), image.Pt(8, 4), 3},
+		{image.Rect(0, 0, 256, 256), image.Pt(1, 1), 3}, // the last level
+	} {
+		r.levels = nil
+		m, err := ReadScaled(r, v.rect, v.size, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Bounds().Size() != v.size {
+			t.Fatalf("%v: bad bounds: %v", v, m.Bounds())
+		}
+		if n := len(r.levels); n == 0 || r.levels[n-1] != v.level {
+			t.Fatalf("%v: bad levels: %v", v, r.levels)
+		}
+	}
+
+	// same level 1 pixels as the overview
+	want, err := r0.ReadOverview(1, image.Rect(0, 0, 128, 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = ReadScaled(r, image.Rect(0, 0, 256, 256), image.Pt(128, 128), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, want, m, m.Bounds())
+}
+
+func TestMultiOverviewImageReader_overviewIndex(t *testing.T) {
+	r := MultiOverviewImageReader([]map[image.Rectangle]ImageReader{
+		{image.Rect(0, 0, 4, 4): &tConstImageReader{w: 4, h: 4, v: 1}},
+		{image.Rect(0, 0, 2, 2): &tConstImageReader{w: 2, h: 2, v: 2}},
+	})
+	if _, err := r.ReadOverview(1, image.Rect(0, 0, 2, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadOverview(5, image.Rect(0, 0, 2, 2)); err != ErrOverviewIndex {
+		t.Fatalf("expect ErrOverviewIndex, got %v", err)
+	}
+}
+
+// tSliceImageReader is a reader of a non-comparable type.
+type tSliceImageReader struct {
+	*tConstImageReader
+	pad []int
+}
+
+func TestMultiOverviewImageReader_close(t *testing.T) {
+	// the levels share a reader
+	shared := &tCloseImageReader{ImageReader: &tConstImageReader{w: 4, h: 4, v: 1}}
+	r := MultiOverviewImageReaderFromLayers([][]MultiLayer{
+		{{Rect: image.Rect(0, 0, 4, 4), Reader: shared}},
+		{{Rect: image.Rect(0, 0, 4, 4), Reader: shared}},
+	}, nil)
+	if err := r.Close(); err != nil || shared.closes != 1 {
+		t.Fatalf("bad closes: %d, %v", shared.closes, err)
+	}
+
+	// a non-comparable reader is not a valid layer
+	bad := tSliceImageReader{tConstImageReader: &tConstImageReader{w: 4, h: 4, v: 1}}
+	r = MultiOverviewImageReaderFromLayers([][]MultiLayer{
+		{{Rect: image.Rect(0, 0, 4, 4), Reader: bad}},
+	}, nil)
+	if _, err := r.Read(image.Rect(0, 0, 4, 4)); err == nil {
+		t.Fatal("expect no reader error")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadScaled_unaligned(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	// the pixel is x/8, the same in the image and the overviews
+	filename := filepath.Join(dir, "a.raw")
+	src := ximage.NewMemPImage(image.Rect(0, 0, 544, 32), 1, reflect.Uint8)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 544; x++ {
+			src.XPix[src.PixOffset(x, y)] = uint8(x / 8)
+		}
+	}
+	w, err := CreateImageWriterWithOptions("raw", filename, 544, 32, 1, reflect.Uint8, &CreateOptions{
+		TileSize: image.Pt(32, 32),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	rect, size := image.Rect(15, 0, 527, 32), image.Pt(64, 4)
+	want, err := ReadScaled(r, rect, size, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+	lr := &tLevelImageReader{ImageReader: r}
+	m, err := ReadScaled(lr, rect, size, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lr.levels, []int{3}) {
+		t.Fatalf("bad levels: %v", lr.levels)
+	}
+	tEqualRect(t, want, m, m.Bounds())
+	if v := m.XPix[m.PixOffset(0, 0)]; v != 2 {
+		t.Fatalf("bad first pixel: %d", v)
+	}
+}
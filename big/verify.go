@@ -0,0 +1,89 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"fmt"
+	"image"
+)
+
+const (
+	DefaultVerifySamples = 16
+)
+
+// VerifyOptions tells how much of the image Verify checks.
+type VerifyOptions struct {
+	Full    bool // checks all the overview tiles
+	Samples int  // overview tiles checked per level if not Full, DefaultVerifySamples if 0
+	Repair  bool // rebuilds the damaged overview tiles
+}
+
+// VerifyProblem is a damaged part of the image, Level is -1 for the header.
+type VerifyProblem struct {
+	Level    int
+	Tile     image.Point // column and row of the tile
+	Message  string
+	Repaired bool
+}
+
+func (p VerifyProblem) String() string {
+	if p.Level < 0 {
+		return fmt.Sprintf("header: %s", p.Message)
+	}
+	s := fmt.Sprintf("level %d, tile %v: %s", p.Level, p.Tile, p.Message)
+	if p.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+	Overviews    bool // the overviews are marked as built
+	TilesChecked int
+	Problems     []VerifyProblem
+}
+
+// OK reports whether all the problems are repaired.
+func (r *VerifyReport) OK() bool {
+	for _, p := range r.Problems {
+		if !p.Repaired {
+			return false
+		}
+	}
+	return true
+}
+
+// Verifier is implemented by the images which can check their header, the
+// tiles and the overviews against the downsampled parent levels.
+//
+// The overviews are verified if they are marked as built. A Full Repair
+// also checks the unbuilt overviews, and marks them as built if all the
+// problems are repaired, it completes an interrupted BuildOverviews.
+type Verifier interface {
+	Verify(ctx context.Context, opt *VerifyOptions) (*VerifyReport, error)
+}
+
+// Verify verifies r, it returns ErrNoVerifyFeature if r is not a Verifier.
+// The returned error is an I/O or ctx error, the damages are in the report.
+func Verify(ctx context.Context, r ImageReader, opt *VerifyOptions) (*VerifyReport, error) {
+	if x, ok := r.(Verifier); ok {
+		return x.Verify(ctx, opt)
+	}
+	return nil, ErrNoVerifyFeature
+}
+
+// verifySamples returns n indexes of [0, total) spread evenly.
+func verifySamples(total, n int) []int {
+	if n <= 0 || n > total {
+		n = total
+	}
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i * total / n
+	}
+	return idx
+}
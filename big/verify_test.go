@@ -0,0 +1,171 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"context"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+)
+
+func tCreateVerifyImage(t *testing.T, filename string) {
+	src := tNewPattern(image.Rect(0, 0, 100, 60), 1, reflect.Uint8)
+	w, err := CreateImageWriterWithOptions("raw", filename, 100, 60, 1, reflect.Uint8, &CreateOptions{
+		TileSize: image.Pt(16, 16),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(src.Bounds(), src); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+}
+
+func TestVerify_repair(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	tCreateVerifyImage(t, filename)
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	ctx := context.Background()
+
+	if err := r.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := r.ReadOverview(1, image.Rect(0, 0, 50, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 50x30: 4x2, 25x15: 2x1, 12x7: 1x1
+	rep, err := Verify(ctx, r, &VerifyOptions{Full: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() || len(rep.Problems) != 0 || !rep.Overviews || rep.TilesChecked != 11 {
+		t.Fatalf("bad report: %+v", rep)
+	}
+
+	// damage the tile (3,1) of the level 1
+	p := r.(*_RawImage)
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{1, 2, 3, 4}, p.tileOffset(1, 3, 1)+3*16); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	rep, err = Verify(ctx, r, &VerifyOptions{Samples: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() || rep.TilesChecked != 3 {
+		t.Fatalf("expect the damage not sampled: %+v", rep)
+	}
+
+	rep, err = Verify(ctx, r, &VerifyOptions{Full: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.OK() || len(rep.Problems) != 1 || rep.Problems[0].Level != 1 || rep.Problems[0].Tile != image.Pt(3, 1) {
+		t.Fatalf("bad report: %+v", rep)
+	}
+
+	// only the damaged tile is rebuilt
+	rep, err = Verify(ctx, CacheImageReader(r, nil), &VerifyOptions{Full: true, Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() || len(rep.Problems) != 1 || !rep.Problems[0].Repaired {
+		t.Fatalf("bad report: %+v", rep)
+	}
+	got, err := r.ReadOverview(1, image.Rect(0, 0, 50, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, got, ximage.NewMemPImageFrom(want), image.Rect(0, 0, 50, 30))
+}
+
+func TestVerify_interrupted(t *testing.T) {
+	dir, cleanup := tTempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "a.raw")
+	tCreateVerifyImage(t, filename)
+
+	r, err := OpenImageReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = BuildOverviewsContext(ctx, r, func(p OverviewsProgress) {
+		if p.Tiles == 5 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+
+	// the unbuilt overviews are not verified
+	rep, err := Verify(context.Background(), r, &VerifyOptions{Full: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() || rep.Overviews || rep.TilesChecked != 0 {
+		t.Fatalf("bad report: %+v", rep)
+	}
+
+	// the 6 tiles not built are repaired
+	rep, err = Verify(context.Background(), r, &VerifyOptions{Full: true, Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() || !rep.Overviews || len(rep.Problems) != 6 {
+		t.Fatalf("bad report: %+v", rep)
+	}
+	if !r.HasOverviews() {
+		t.Fatal("expect overviews")
+	}
+	rep, err = Verify(context.Background(), r, &VerifyOptions{Full: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.OK() || len(rep.Problems) != 0 {
+		t.Fatalf("bad report: %+v", rep)
+	}
+
+	// the last tile of the image is missing
+	if err := os.Truncate(filename, r.(*_RawImage).tileOffset(0, 6, 3)); err != nil {
+		t.Fatal(err)
+	}
+	rep, err = Verify(context.Background(), r, &VerifyOptions{Full: true, Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.OK() || rep.Problems[0].Level != -1 || rep.Problems[1].Tile != image.Pt(6, 3) || rep.Problems[1].Repaired {
+		t.Fatalf("bad report: %+v", rep)
+	}
+
+	if _, err := Verify(context.Background(), NewMemImage(image.NewGray(image.Rect(0, 0, 4, 4))), nil); err != ErrNoVerifyFeature {
+		t.Fatalf("expect ErrNoVerifyFeature, got %v", err)
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"reflect"
+
+	ximage "github.com/chai2010/image"
+)
+
+// The virtual readers read their sources on Read, they are safe for
+// concurrent use if the sources are. Close closes the sources.
+
+var (
+	_ ImageReader = (*_BandStackImageReader)(nil)
+	_ ImageReader = (*_WindowImageReader)(nil)
+	_ ImageReader = (*_DecimateImageReader)(nil)
+
+	_ GeoImage      = (*_BandStackImageReader)(nil)
+	_ GeoImage      = (*_WindowImageReader)(nil)
+	_ GeoImage      = (*_DecimateImageReader)(nil)
+	_ MetadataImage = (*_BandStackImageReader)(nil)
+	_ MetadataImage = (*_WindowImageReader)(nil)
+	_ MetadataImage = (*_DecimateImageReader)(nil)
+)
+
+func asMemPImage(m image.Image) *ximage.MemPImage {
+	if p, ok := ximage.AsMemPImage(m); ok {
+		return p
+	}
+	return ximage.NewMemPImageFrom(m)
+}
+
+func geoReferenceOf(r ImageReader) (*GeoReference, bool) {
+	if x, _ := r.(GeoImage); x != nil {
+		return x.GeoReference()
+	}
+	return nil, false
+}
+
+func metadataOf(r ImageReader) (*Metadata, bool) {
+	if x, _ := r.(MetadataImage); x != nil {
+		return x.Metadata()
+	}
+	return nil, false
+}
+
+func noDataOf(r ImageReader) (float64, bool) {
+	if x, _ := r.(NoDataImage); x != nil {
+		return x.NoData()
+	}
+	return 0, false
+}
+
+// tileSizeOf returns the tile size of r, or zero if r is not tiled.
+func tileSizeOf(r ImageReader) image.Point {
+	if x, _ := r.(TiledImage); x != nil {
+		return x.TileSize()
+	}
+	return image.Point{}
+}
+
+// ----------------------------------------------------------------------------
+
+type _BandStackImageReader struct {
+	readers  []ImageReader
+	channels int
+}
+
+// BandStackImageReader returns a reader whose channels are the channels of
+// the readers in order, the readers must have the same size and DataType.
+func BandStackImageReader(readers ...ImageReader) (ImageReader, error) {
+	if len(readers) == 0 {
+		return nil, errors.New("image/big: BandStackImageReader, no reader!")
+	}
+	p := &_BandStackImageReader{readers: readers}
+	r0 := readers[0]
+	for i, r := range readers {
+		if r.Width() != r0.Width() || r.Height() != r0.Height() || r.DataType() != r0.DataType() {
+			return nil, fmt.Errorf("image/big: BandStackImageReader, reader %d mismatch: %dx%d, %v != %dx%d, %v",
+				i, r.Width(), r.Height(), r.DataType(), r0.Width(), r0.Height(), r0.DataType(),
+			)
+		}
+		p.channels += r.Channels()
+	}
+	return p, nil
+}
+
+// Close closes each reader once, a reader may be stacked more than once.
+func (p *_BandStackImageReader) Close() error {
+	var firstErr error
+	closed := make(map[ImageReader]bool)
+	for _, r := range p.readers {
+		if isComparable(r) {
+			if closed[r] {
+				continue
+			}
+			closed[r] = true
+		}
+		if err := r.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (p *_BandStackImageReader) Width() int {
+	return p.readers[0].Width()
+}
+func (p *_BandStackImageReader) Height() int {
+	return p.readers[0].Height()
+}
+func (p *_BandStackImageReader) Channels() int {
+	return p.channels
+}
+func (p *_BandStackImageReader) DataType() reflect.Kind {
+	return p.readers[0].DataType()
+}
+
+func (p *_BandStackImageReader) HasOverviews() bool {
+	for _, r := range p.readers {
+		if !r.HasOverviews() {
+			return false
+		}
+	}
+	return true
+}
+func (p *_BandStackImageReader) HasOverviewsFeature() bool {
+	for _, r := range p.readers {
+		if !r.HasOverviewsFeature() {
+			return false
+		}
+	}
+	return true
+}
+func (p *_BandStackImageReader) BuildOverviews() error {
+	for _, r := range p.readers {
+		if err := r.BuildOverviews(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (p *_BandStackImageReader) BuildOverviewsIfNotExists() error {
+	for _, r := range p.readers {
+		if err := r.BuildOverviewsIfNotExists(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *_BandStackImageReader) Read(r image.Rectangle) (m image.Image, err error) {
+	return p.ReadOverview(0, r)
+}
+
+func (p *_BandStackImageReader) ReadOverview(idxOverview int, r image.Rectangle) (m image.Image, err error) {
+	if r.Empty() {
+		return nil, errors.New("image/big: _BandStackImageReader.Read, empty rect!")
+	}
+
+	dataType := p.DataType()
+	size := ximage.SizeofKind(dataType)
+	dst := ximage.NewMemPImage(image.Rect(0, 0, r.Dx(), r.Dy()), p.channels, dataType)
+
+	off := 0 // first channel of the reader
+	for _, reader := range p.readers {
+		var sub image.Image
+		if idxOverview == 0 {
+			sub, err = reader.Read(r)
+		} else {
+			sub, err = reader.ReadOverview(idxOverview, r)
+		}
+		if err != nil {
+			return nil, err
+		}
+		src := asMemPImage(sub)
+		if src.XChannels != reader.Channels() || src.XDataType != dataType {
+			return nil, errors.New("image/big: _BandStackImageReader.Read, pixel type mismatch!")
+		}
+
+		sp, n := src.Bounds().Min, src.XChannels*size
+		for y := 0; y < r.Dy(); y++ {
+			for x := 0; x < r.Dx(); x++ {
+				copy(
+					dst.XPix[dst.PixOffset(x, y)+off*size:][:n],
+					src.XPix[src.PixOffset(sp.X+x, sp.Y+y):][:n],
+				)
+			}
+		}
+		off += src.XChannels
+	}
+	return dst, nil
+}
+
+// GeoReference returns the georeference of the first reader.
+func (p *_BandStackImageReader) GeoReference() (g *GeoReference, ok bool) {
+	return geoReferenceOf(p.readers[0])
+}
+
+// Metadata returns the bands of the readers, and the tags of the first.
+func (p *_BandStackImageReader) Metadata() (md *Metadata, ok bool) {
+	md = new(Metadata)
+	for _, r := range p.readers {
+		bands := make([]BandInfo, r.Channels())
+		if v, _ := metadataOf(r); v != nil {
+			copy(bands, v.Bands)
+			if md.Tags == nil {
+				md.Tags = v.Clone().Tags
+			}
+			ok = true
+		}
+		md.Bands = append(md.Bands, bands...)
+	}
+	if !ok {
+		return nil, false
+	}
+	return md, true
+}
+
+// ----------------------------------------------------------------------------
+
+type _WindowImageReader struct {
+	ImageReader
+	window image.Rectangle
+}
+
+// WindowImageReader returns the window of r as a reader starting at (0,0).
+// The overview i of the window is the window>>i of the overview i of r,
+// the edges are rounded to the overview pixels.
+func WindowImageReader(r ImageReader, window image.Rectangle) (ImageReader, error) {
+	if window.Empty() || !window.In(image.Rect(0, 0, r.Width(), r.Height())) {
+		return nil, fmt.Errorf("image/big: WindowImageReader, invalid window: %v", window)
+	}
+	return &_WindowImageReader{ImageReader: r, window: window}, nil
+}
+
+func (p *_WindowImageReader) Width() int {
+	return p.window.Dx()
+}
+func (p *_WindowImageReader) Height() int {
+	return p.window.Dy()
+}
+
+func (p *_WindowImageReader) Read(r image.Rectangle) (m image.Image, err error) {
+	return p.ReadOverview(0, r)
+}
+
+func (p *_WindowImageReader) ReadOverview(idxOverview int, r image.Rectangle) (m image.Image, err error) {
+	if idxOverview < 0 {
+		return nil, errors.New("image/big: _WindowImageReader.ReadOverview, invalid idxOverview!")
+	}
+	if r.Empty() {
+		return nil, errors.New("image/big: _WindowImageReader.Read, empty rect!")
+	}
+
+	// the window of the level, in the level and the window coordinates
+	lw := scaledRect(p.window, idxOverview)
+	lb := image.Rect(0, 0, lw.Dx(), lw.Dy())
+
+	dst := ximage.NewMemPImage(image.Rect(0, 0, r.Dx(), r.Dy()), p.Channels(), p.DataType())
+	z := r.Intersect(lb)
+	if z.Empty() {
+		return dst, nil
+	}
+	if idxOverview == 0 {
+		m, err = p.ImageReader.Read(z.Add(lw.Min))
+	} else {
+		m, err = p.ImageReader.ReadOverview(idxOverview, z.Add(lw.Min))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if z == r {
+		return m, nil
+	}
+	src := asMemPImage(m)
+	if src.XChannels != dst.XChannels || src.XDataType != dst.XDataType {
+		return nil, errors.New("image/big: _WindowImageReader.Read, pixel type mismatch!")
+	}
+	sp, n := src.Bounds().Min, z.Dx()*ximage.SizeofPixel(dst.XChannels, dst.XDataType)
+	for y := 0; y < z.Dy(); y++ {
+		copy(
+			dst.XPix[dst.PixOffset(z.Min.X-r.Min.X, z.Min.Y-r.Min.Y+y):][:n],
+			src.XPix[src.PixOffset(sp.X, sp.Y+y):][:n],
+		)
+	}
+	return dst, nil
+}
+
+func (p *_WindowImageReader) GeoReference() (g *GeoReference, ok bool) {
+	if g, ok = geoReferenceOf(p.ImageReader); ok {
+		g.Transform = g.Transform.Translate(p.window.Min)
+	}
+	return
+}
+
+func (p *_WindowImageReader) Metadata() (md *Metadata, ok bool) {
+	return metadataOf(p.ImageReader)
+}
+
+// ----------------------------------------------------------------------------
+
+type _DecimateImageReader struct {
+	ImageReader
+	factor int
+}
+
+// DecimateImageReader returns a reader whose pixel (x,y) is the pixel
+// (x*factor,y*factor) of r, without interpolation. The overview i is the
+// overview i of r decimated by factor.
+func DecimateImageReader(r ImageReader, factor int) (ImageReader, error) {
+	if factor <= 0 {
+		return nil, fmt.Errorf("image/big: DecimateImageReader, invalid factor: %d", factor)
+	}
+	return &_DecimateImageReader{ImageReader: r, factor: factor}, nil
+}
+
+func (p *_DecimateImageReader) Width() int {
+	return (p.ImageReader.Width() + p.factor - 1) / p.factor
+}
+func (p *_DecimateImageReader) Height() int {
+	return (p.ImageReader.Height() + p.factor - 1) / p.factor
+}
+
+func (p *_DecimateImageReader) Read(r image.Rectangle) (m image.Image, err error) {
+	return p.ReadOverview(0, r)
+}
+
+// ReadOverview reads the source row by row, so only the used rows are read,
+// and the memory does not grow with the square of the factor.
+func (p *_DecimateImageReader) ReadOverview(idxOverview int, r image.Rectangle) (m image.Image, err error) {
+	if idxOverview < 0 {
+		return nil, errors.New("image/big: _DecimateImageReader.ReadOverview, invalid idxOverview!")
+	}
+	if r.Empty() {
+		return nil, errors.New("image/big: _DecimateImageReader.Read, empty rect!")
+	}
+
+	f := p.factor
+	dst := ximage.NewMemPImage(image.Rect(0, 0, r.Dx(), r.Dy()), p.Channels(), p.DataType())
+	n := ximage.SizeofPixel(dst.XChannels, dst.XDataType)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sr := image.Rect(r.Min.X*f, y*f, (r.Max.X-1)*f+1, y*f+1)
+		var row image.Image
+		if idxOverview == 0 {
+			row, err = p.ImageReader.Read(sr)
+		} else {
+			row, err = p.ImageReader.ReadOverview(idxOverview, sr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		src := asMemPImage(row)
+		if src.XChannels != dst.XChannels || src.XDataType != dst.XDataType {
+			return nil, errors.New("image/big: _DecimateImageReader.Read, pixel type mismatch!")
+		}
+		sp := src.Bounds().Min
+		for x := 0; x < r.Dx(); x++ {
+			copy(
+				dst.XPix[dst.PixOffset(x, y-r.Min.Y):][:n],
+				src.XPix[src.PixOffset(sp.X+x*f, sp.Y):][:n],
+			)
+		}
+	}
+	return dst, nil
+}
+
+func (p *_DecimateImageReader) GeoReference() (g *GeoReference, ok bool) {
+	if g, ok = geoReferenceOf(p.ImageReader); ok {
+		s := 1 / float64(p.factor)
+		g.Transform = g.Transform.Scale(s, s)
+	}
+	return
+}
+
+func (p *_DecimateImageReader) Metadata() (md *Metadata, ok bool) {
+	return metadataOf(p.ImageReader)
+}
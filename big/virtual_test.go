@@ -0,0 +1,232 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"testing"
+
+	ximage "github.com/chai2010/image"
+)
+
+// tCloseImageReader counts the closes.
+type tCloseImageReader struct {
+	ImageReader
+	closes int
+}
+
+func (p *tCloseImageReader) Close() error {
+	p.closes++
+	return p.ImageReader.Close()
+}
+
+func TestBandStackImageReader(t *testing.T) {
+	a := tNewPattern(image.Rect(0, 0, 400, 30), 1, reflect.Uint16)
+	b := tNewPattern(image.Rect(0, 0, 400, 30), 2, reflect.Uint16)
+	for i := range b.XPix {
+		b.XPix[i] ^= 0x5a
+	}
+	ra, rb := NewMemImage(a), NewMemImage(b)
+	if err := rb.(MetadataWriter).SetMetadata(&Metadata{Bands: []BandInfo{{Description: "nir"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := BandStackImageReader(ra, rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Width() != 400 || r.Height() != 30 || r.Channels() != 3 || r.DataType() != reflect.Uint16 {
+		t.Fatalf("bad image: %dx%d, %d, %v", r.Width(), r.Height(), r.Channels(), r.DataType())
+	}
+
+	rect := image.Rect(390, 20, 410, 40)
+	m, err := r.Read(rect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := ximage.AsMemPImage(m)
+	if p.Bounds() != image.Rect(0, 0, 20, 20) {
+		t.Fatalf("bad bounds: %v", p.Bounds())
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			want := make([]byte, 6)
+			if image.Pt(x, y).In(a.Bounds()) {
+				want = append(append([]byte{}, a.PixelAt(x, y)...), b.PixelAt(x, y)...)
+			}
+			if got := p.PixelAt(x-rect.Min.X, y-rect.Min.Y); !bytes.Equal(got, want) {
+				t.Fatalf("(%d,%d): %v != %v", x, y, got, want)
+			}
+		}
+	}
+
+	md, ok := r.(MetadataImage).Metadata()
+	if !ok || len(md.Bands) != 3 || md.Bands[0].Description != "" || md.Bands[1].Description != "nir" {
+		t.Fatalf("bad metadata: %v, %+v", ok, md)
+	}
+
+	if r.HasOverviews() {
+		t.Fatal("expect no overviews")
+	}
+	if err := r.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+	if !ra.HasOverviews() || !rb.HasOverviews() || !r.HasOverviews() {
+		t.Fatal("expect overviews")
+	}
+	if _, err := r.ReadOverview(1, image.Rect(0, 0, 200, 15)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := CreateMemImage(400, 30, 1, reflect.Uint8)
+	if _, err := BandStackImageReader(ra, c); err == nil {
+		t.Fatal("expect data type error")
+	}
+	d, _ := CreateMemImage(400, 31, 1, reflect.Uint16)
+	if _, err := BandStackImageReader(ra, d); err == nil {
+		t.Fatal("expect size error")
+	}
+
+	// a reader stacked twice is closed once
+	rc := &tCloseImageReader{ImageReader: ra}
+	if r, err = BandStackImageReader(rc, rb, rc); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil || rc.closes != 1 {
+		t.Fatalf("bad closes: %d, %v", rc.closes, err)
+	}
+}
+
+func TestWindowImageReader(t *testing.T) {
+	src := tNewPattern(image.Rect(0, 0, 640, 48), 3, reflect.Uint8)
+	base := NewMemImage(src)
+	if err := base.(GeoWriter).SetGeoReference(&GeoReference{
+		Transform: GeoTransform{100, 2, 0, 500, 0, -2},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	window := image.Rect(16, 8, 48, 40)
+	r, err := WindowImageReader(base, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Width() != 32 || r.Height() != 32 {
+		t.Fatalf("bad size: %dx%d", r.Width(), r.Height())
+	}
+
+	// the pixels outside the window are zero
+	want := ximage.NewMemPImage(image.Rect(0, 0, 40, 40), 3, reflect.Uint8)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			want.SetPixel(x, y, src.PixelAt(x+16, y+8))
+		}
+	}
+	for _, rect := range []image.Rectangle{
+		image.Rect(0, 0, 32, 32),
+		image.Rect(5, 7, 19, 11),
+		image.Rect(24, 24, 40, 40),
+	} {
+		m, err := r.Read(rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, m, want, rect)
+	}
+	if m, err := r.Read(image.Rect(32, 0, 40, 8)); err != nil {
+		t.Fatal(err)
+	} else {
+		tEqualRect(t, m, want, image.Rect(32, 0, 40, 8))
+	}
+
+	g, ok := r.(GeoImage).GeoReference()
+	if !ok || g.Transform != (GeoTransform{132, 2, 0, 484, 0, -2}) {
+		t.Fatalf("bad geo: %v, %+v", ok, g)
+	}
+
+	// the aligned window of the overview
+	if err := base.BuildOverviews(); err != nil {
+		t.Fatal(err)
+	}
+	m0, err := base.ReadOverview(2, image.Rect(4, 2, 12, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, err := r.ReadOverview(2, image.Rect(0, 0, 8, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tEqualRect(t, m1, ximage.NewMemPImageFrom(m0), image.Rect(0, 0, 8, 8))
+
+	for _, w := range []image.Rectangle{
+		image.Rect(0, 0, 0, 10),
+		image.Rect(-1, 0, 10, 10),
+		image.Rect(630, 40, 645, 48),
+	} {
+		if _, err := WindowImageReader(base, w); err == nil {
+			t.Fatalf("%v: expect invalid window", w)
+		}
+	}
+}
+
+func TestDecimateImageReader(t *testing.T) {
+	src := tNewPattern(image.Rect(0, 0, 520, 31), 2, reflect.Uint8)
+	base := NewMemImage(src)
+	if err := base.(GeoWriter).SetGeoReference(&GeoReference{
+		Transform: GeoTransform{100, 2, 0, 500, 0, -2},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := DecimateImageReader(base, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Width() != 174 || r.Height() != 11 {
+		t.Fatalf("bad size: %dx%d", r.Width(), r.Height())
+	}
+
+	want := ximage.NewMemPImage(image.Rect(0, 0, 20, 20), 2, reflect.Uint8)
+	for y := 0; y < 11; y++ {
+		for x := 0; x < 20; x++ {
+			want.SetPixel(x, y, src.PixelAt(x*3, y*3))
+		}
+	}
+	for _, rect := range []image.Rectangle{
+		image.Rect(0, 0, 20, 11),
+		image.Rect(3, 4, 9, 7),
+		image.Rect(10, 5, 20, 20),
+	} {
+		m, err := r.Read(rect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tEqualRect(t, m, want, rect)
+	}
+
+	// one source row is read for each result row
+	rc := &tLevelImageReader{ImageReader: base}
+	rd, _ := DecimateImageReader(rc, 3)
+	if _, err := rd.Read(image.Rect(2, 1, 15, 9)); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.levels) != 8 {
+		t.Fatalf("%d source reads", len(rc.levels))
+	}
+
+	g, ok := r.(GeoImage).GeoReference()
+	if !ok || g.Transform != (GeoTransform{100, 6, 0, 500, 0, -6}) {
+		t.Fatalf("bad geo: %v, %+v", ok, g)
+	}
+
+	if _, err := r.ReadOverview(1, image.Rect(0, 0, 4, 4)); err != ErrNoOverviews {
+		t.Fatalf("expect ErrNoOverviews, got %v", err)
+	}
+	if _, err := DecimateImageReader(base, 0); err == nil {
+		t.Fatal("expect invalid factor")
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoExif = errors.New("image: no exif")
+)
+
+// Exif holds the commonly used EXIF tags of JPEG and TIFF files.
+type Exif struct {
+	Orientation      int // 1-8, 0 if unknown
+	Make             string
+	Model            string
+	Software         string
+	LensModel        string
+	DateTime         time.Time
+	DateTimeOriginal time.Time
+	ExposureTime     float64 // seconds
+	FNumber          float64
+	FocalLength      float64 // mm
+	ISOSpeed         int
+}
+
+const (
+	exifTagMake             = 0x010F
+	exifTagModel            = 0x0110
+	exifTagOrientation      = 0x0112
+	exifTagSoftware         = 0x0131
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagExposureTime     = 0x829A
+	exifTagFNumber          = 0x829D
+	exifTagISOSpeed         = 0x8827
+	exifTagDateTimeOriginal = 0x9003
+	exifTagFocalLength      = 0x920A
+	exifTagLensModel        = 0xA434
+)
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// DecodeExif reads the EXIF of a JPEG or TIFF stream.
+func DecodeExif(r io.Reader) (x *Exif, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseExif(data)
+}
+
+// LoadExif reads the EXIF of a JPEG or TIFF file.
+func LoadExif(filename string) (x *Exif, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseExif(data)
+}
+
+func parseExif(data []byte) (*Exif, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xFF\xD8")):
+		tiff, err := findJpegExif(data)
+		if err != nil {
+			return nil, err
+		}
+		return parseExifTiff(tiff)
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return parseExifTiff(data)
+	}
+	return nil, ErrNoExif
+}
+
+// findJpegExif returns the TIFF data of the APP1 Exif segment.
+func findJpegExif(data []byte) ([]byte, error) {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil, ErrNoExif
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // SOS or EOI
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			break
+		}
+		seg := data[i+4 : i+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:], nil
+		}
+		i += 2 + n
+	}
+	return nil, ErrNoExif
+}
+
+type exifReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func parseExifTiff(data []byte) (*Exif, error) {
+	if len(data) < 8 {
+		return nil, ErrNoExif
+	}
+	p := &exifReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		p.order = binary.LittleEndian
+	case "MM":
+		p.order = binary.BigEndian
+	default:
+		return nil, ErrNoExif
+	}
+	if p.order.Uint16(data[2:]) != 42 {
+		return nil, ErrNoExif
+	}
+
+	x := new(Exif)
+	if err := p.readIFD(x, int(p.order.Uint32(data[4:])), true); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (p *exifReader) readIFD(x *Exif, off int, top bool) error {
+	if off < 8 || off+2 > len(p.data) {
+		return errors.New("image: exif, bad ifd offset")
+	}
+	n := int(p.order.Uint16(p.data[off:]))
+	if off+2+n*12 > len(p.data) {
+		return errors.New("image: exif, bad ifd entry count")
+	}
+
+	for i := 0; i < n; i++ {
+		e := p.data[off+2+i*12:][:12]
+		tag := p.order.Uint16(e[0:])
+		typ := p.order.Uint16(e[2:])
+		cnt := int(p.order.Uint32(e[4:]))
+		val := p.value(typ, cnt, e[8:12])
+		if val == nil {
+			continue
+		}
+
+		switch tag {
+		case exifTagMake:
+			x.Make = p.ascii(typ, val)
+		case exifTagModel:
+			x.Model = p.ascii(typ, val)
+		case exifTagSoftware:
+			x.Software = p.ascii(typ, val)
+		case exifTagLensModel:
+			x.LensModel = p.ascii(typ, val)
+		case exifTagOrientation:
+			if v := p.uint(typ, val); v >= 1 && v <= 8 {
+				x.Orientation = int(v)
+			}
+		case exifTagDateTime:
+			x.DateTime, _ = time.Parse(exifTimeLayout, p.ascii(typ, val))
+		case exifTagDateTimeOriginal:
+			x.DateTimeOriginal, _ = time.Parse(exifTimeLayout, p.ascii(typ, val))
+		case exifTagExposureTime:
+			x.ExposureTime = p.rational(typ, val)
+		case exifTagFNumber:
+			x.FNumber = p.rational(typ, val)
+		case exifTagFocalLength:
+			x.FocalLength = p.rational(typ, val)
+		case exifTagISOSpeed:
+			x.ISOSpeed = int(p.uint(typ, val))
+		case exifTagExifIFD:
+			if top {
+				if err := p.readIFD(x, int(p.uint(typ, val)), false); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// value returns the raw bytes of an IFD entry value.
+func (p *exifReader) value(typ uint16, cnt int, v []byte) []byte {
+	var size int
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		size = 1
+	case 3, 8: // SHORT, SSHORT
+		size = 2
+	case 4, 9: // LONG, SLONG
+		size = 4
+	case 5, 10: // RATIONAL, SRATIONAL
+		size = 8
+	default:
+		return nil
+	}
+	if cnt <= 0 || cnt > len(p.data)/size {
+		return nil
+	}
+	n := size * cnt
+	if n <= 4 {
+		return v[:n]
+	}
+	off := int(p.order.Uint32(v))
+	if off < 0 || off+n > len(p.data) {
+		return nil
+	}
+	return p.data[off:][:n]
+}
+
+func (p *exifReader) ascii(typ uint16, v []byte) string {
+	if typ != 2 {
+		return ""
+	}
+	if i := bytes.IndexByte(v, 0); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(string(v))
+}
+
+func (p *exifReader) uint(typ uint16, v []byte) uint32 {
+	switch typ {
+	case 1, 7:
+		return uint32(v[0])
+	case 3:
+		return uint32(p.order.Uint16(v))
+	case 4:
+		return p.order.Uint32(v)
+	}
+	return 0
+}
+
+func (p *exifReader) rational(typ uint16, v []byte) float64 {
+	switch typ {
+	case 5:
+		if d := p.order.Uint32(v[4:]); d != 0 {
+			return float64(p.order.Uint32(v)) / float64(d)
+		}
+	case 10:
+		if d := int32(p.order.Uint32(v[4:])); d != 0 {
+			return float64(int32(p.order.Uint32(v))) / float64(d)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"reflect"
+	"testing"
+)
+
+// tMakeExifJpeg returns a jpeg with an APP1 segment holding Make and Orientation.
+func tMakeExifJpeg(t *testing.T, m image.Image, camera string, orientation int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, m, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	entry := func(tag, typ uint16, count uint32, value [4]byte) {
+		binary.Write(&tiff, le, tag)
+		binary.Write(&tiff, le, typ)
+		binary.Write(&tiff, le, count)
+		tiff.Write(value[:])
+	}
+
+	tiff.WriteString("II*\x00")
+	binary.Write(&tiff, le, uint32(8))
+	binary.Write(&tiff, le, uint16(2))
+
+	var makeOffset [4]byte
+	le.PutUint32(makeOffset[:], 8+2+2*12+4) // stored after the IFD
+	entry(exifTagMake, 2, uint32(len(camera)+1), makeOffset)
+	entry(exifTagOrientation, 3, 1, [4]byte{byte(orientation)})
+
+	binary.Write(&tiff, le, uint32(0)) // next IFD
+	tiff.WriteString(camera + "\x00")
+	data := tiff.Bytes()
+
+	var app1 bytes.Buffer
+	app1.WriteString("\xFF\xE1")
+	binary.Write(&app1, binary.BigEndian, uint16(2+6+len(data)))
+	app1.WriteString("Exif\x00\x00")
+	app1.Write(data)
+
+	jpg := buf.Bytes()
+	return append(append(append([]byte(nil), jpg[:2]...), app1.Bytes()...), jpg[2:]...)
+}
+
+func TestDecodeWithExif(t *testing.T) {
+	m0 := NewMemPImage(image.Rect(0, 0, 40, 20), 4, reflect.Uint8)
+	data := tMakeExifJpeg(t, m0, "Gopher", 6)
+
+	m, x, format, err := DecodeWithExif(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" {
+		t.Fatalf("format: %q", format)
+	}
+	if x == nil || x.Make != "Gopher" || x.Orientation != 6 {
+		t.Fatalf("bad exif: %+v", x)
+	}
+	if b := m.Bounds(); b.Dx() != 40 || b.Dy() != 20 {
+		t.Fatalf("bad bounds: %v", b)
+	}
+
+	if _, x, _, _ = DecodeWithExif(bytes.NewReader(data[:2])); x != nil {
+		t.Fatalf("expect no exif: %+v", x)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	m := NewMemPImage(image.Rect(0, 0, 3, 2), 1, reflect.Uint8)
+	copy(m.XPix, []byte{
+		1, 2, 3,
+		4, 5, 6,
+	})
+
+	for _, v := range []struct {
+		orientation int
+		pix         []byte
+	}{
+		{1, []byte{1, 2, 3, 4, 5, 6}},
+		{2, []byte{3, 2, 1, 6, 5, 4}},
+		{3, []byte{6, 5, 4, 3, 2, 1}},
+		{4, []byte{4, 5, 6, 1, 2, 3}},
+		{5, []byte{1, 4, 2, 5, 3, 6}},
+		{6, []byte{4, 1, 5, 2, 6, 3}},
+		{7, []byte{6, 3, 5, 2, 4, 1}},
+		{8, []byte{3, 6, 2, 5, 1, 4}},
+	} {
+		p := ApplyOrientation(m, v.orientation)
+		if !bytes.Equal(p.XPix, v.pix) {
+			t.Fatalf("orientation %d: %v != %v", v.orientation, p.XPix, v.pix)
+		}
+	}
+}
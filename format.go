@@ -0,0 +1,162 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+)
+
+const (
+	maxDecodeChannels = 1 << 12
+	maxDecodeBytes    = 1 << 50 // pixel bytes of a decoded image
+)
+
+// A formatInto holds an image format's name, magic header and how to
+// decode it into a preallocated MemPImage.
+type formatInto struct {
+	name, magic string
+	decodeInto  func(r io.Reader, dst *MemPImage) error
+}
+
+var (
+	formatsIntoMu sync.Mutex
+	formatsInto   []formatInto
+)
+
+// RegisterFormatInto registers an image format for use by DecodeImageInto.
+//
+// Name is the name of the format, like "memp". Magic is the magic prefix
+// that identifies the format's encoding, the same as image.RegisterFormat.
+// DecodeInto must write the decoded rows directly into dst, and return an
+// error if the encoded image does not fit dst. The reader r also implements
+// io.ReaderAt from the start of the image if the input supports random
+// access.
+func RegisterFormatInto(name, magic string, decodeInto func(r io.Reader, dst *MemPImage) error) {
+	formatsIntoMu.Lock()
+	defer formatsIntoMu.Unlock()
+	formatsInto = append(formatsInto, formatInto{name, magic, decodeInto})
+}
+
+// A reader is an io.Reader that can also peek ahead.
+type reader interface {
+	io.Reader
+	Peek(int) ([]byte, error)
+}
+
+// asReader converts an io.Reader to a reader.
+func asReader(r io.Reader) reader {
+	if rr, ok := r.(reader); ok {
+		return rr
+	}
+	return bufio.NewReader(r)
+}
+
+// A byteReader is an io.Reader that can also read a byte.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// asByteReader converts an io.Reader to a byteReader.
+func asByteReader(r io.Reader) byteReader {
+	if rr, ok := r.(byteReader); ok {
+		return rr
+	}
+	return bufio.NewReader(r)
+}
+
+// readerAt is the reader passed to the decoders of DecodeImageInto when
+// the input supports random access, ReaderAt starts at the image.
+type readerAt struct {
+	reader
+	io.ReaderAt
+}
+
+// sectionReaderAt returns the random access to r from its current
+// offset, or nil.
+func sectionReaderAt(r io.Reader) io.ReaderAt {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return nil
+	}
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	off, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	return io.NewSectionReader(ra, off, math.MaxInt64-off)
+}
+
+// pixBytes returns the pixel bytes of a decoded image, ok is false if
+// the header values are out of the limits or the size overflows.
+func pixBytes(width, height, channels int, dataType reflect.Kind) (n int64, ok bool) {
+	size := SizeofKind(dataType)
+	if width < 0 || height < 0 || channels <= 0 || channels > maxDecodeChannels || size == 0 {
+		return 0, false
+	}
+	n = int64(channels * size)
+	for _, v := range []int{width, height} {
+		if v > 0 && n > maxDecodeBytes/int64(v) {
+			return 0, false
+		}
+		n *= int64(v)
+	}
+	if int64(int(n)) != n {
+		return 0, false
+	}
+	return n, true
+}
+
+// readPix reads the n pixel bytes, the buffer grows with the read data,
+// so a crafted header can not allocate more than the input.
+func readPix(r io.Reader, n int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if n < 1<<20 {
+		buf.Grow(int(n))
+	}
+	if _, err := io.CopyN(&buf, r, n); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// match reports whether magic matches b. Magic may contain "?" wildcards.
+func match(magic string, b []byte) bool {
+	if len(magic) != len(b) {
+		return false
+	}
+	for i, c := range b {
+		if magic[i] != c && magic[i] != '?' {
+			return false
+		}
+	}
+	return true
+}
+
+// sniffInto determines the format of r's data.
+func sniffInto(r reader) formatInto {
+	formatsIntoMu.Lock()
+	formats := formatsInto
+	formatsIntoMu.Unlock()
+
+	for _, f := range formats {
+		b, err := r.Peek(len(f.magic))
+		if err == nil && match(f.magic, b) {
+			return f
+		}
+	}
+	return formatInto{}
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"reflect"
+)
+
+// DecodeOptions limits the image size before decoding, zero means no limit.
+type DecodeOptions struct {
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int
+	MaxBytes  int // Width * Height * SizeofPixel(Channels, DataType)
+}
+
+// DecodeLimitError reports an image which exceeds a DecodeOptions limit.
+type DecodeLimitError struct {
+	Limit    string // "width", "height", "pixels" or "bytes"
+	Max      int
+	Width    int
+	Height   int
+	Channels int
+	DataType reflect.Kind
+}
+
+func (e *DecodeLimitError) Error() string {
+	return fmt.Sprintf("image: %dx%d (%d, %v) image exceeds max %s %d",
+		e.Width, e.Height, e.Channels, e.DataType, e.Limit, e.Max,
+	)
+}
+
+// Check checks the config returned by DecodeConfig.
+func (opt *DecodeOptions) Check(cfg image.Config) error {
+	return opt.CheckSize(cfg.Width, cfg.Height, ChannelsOf(cfg.ColorModel), DataTypeOf(cfg.ColorModel))
+}
+
+func (opt *DecodeOptions) CheckSize(width, height, channels int, dataType reflect.Kind) error {
+	if opt == nil {
+		return nil
+	}
+	newErr := func(limit string, max int) error {
+		return &DecodeLimitError{
+			Limit:    limit,
+			Max:      max,
+			Width:    width,
+			Height:   height,
+			Channels: channels,
+			DataType: dataType,
+		}
+	}
+	if opt.MaxWidth > 0 && width > opt.MaxWidth {
+		return newErr("width", opt.MaxWidth)
+	}
+	if opt.MaxHeight > 0 && height > opt.MaxHeight {
+		return newErr("height", opt.MaxHeight)
+	}
+
+	// int64 avoids overflow with crafted headers
+	pixels := int64(width) * int64(height)
+	if opt.MaxPixels > 0 && pixels > int64(opt.MaxPixels) {
+		return newErr("pixels", opt.MaxPixels)
+	}
+	if opt.MaxBytes > 0 && pixels*int64(SizeofPixel(channels, dataType)) > int64(opt.MaxBytes) {
+		return newErr("bytes", opt.MaxBytes)
+	}
+	return nil
+}
+
+func DecodeWithOptions(r io.Reader, opt *DecodeOptions) (m image.Image, format string, err error) {
+	if opt == nil {
+		return Decode(r)
+	}
+
+	var buf bytes.Buffer
+	cfg, _, err := DecodeConfig(io.TeeReader(r, &buf))
+	if err != nil {
+		return nil, "", err
+	}
+	if err = opt.Check(cfg); err != nil {
+		return nil, "", err
+	}
+	return Decode(io.MultiReader(&buf, r))
+}
+
+func DecodeImageWithOptions(r io.Reader, opt *DecodeOptions) (m *MemPImage, format string, err error) {
+	x, format, err := DecodeWithOptions(r, opt)
+	if err != nil {
+		return nil, "", err
+	}
+	if m, _ = AsMemPImage(x); m == nil {
+		m = NewMemPImageFrom(x)
+	}
+	return m, format, nil
+}
+
+func LoadWithOptions(filename string, opt *DecodeOptions) (m image.Image, format string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return DecodeWithOptions(f, opt)
+}
+
+// LoadExWithOptions checks the limits before calling loader if the format
+// is known by LoadConfig, otherwise it checks the loaded image.
+func LoadExWithOptions(filename string, loader Loader, opt *DecodeOptions) (m image.Image, format string, err error) {
+	if loader == nil {
+		return LoadWithOptions(filename, opt)
+	}
+	if opt == nil {
+		return LoadEx(filename, loader)
+	}
+
+	cfg, _, errCfg := LoadConfig(filename)
+	if errCfg == nil {
+		if err = opt.Check(cfg); err != nil {
+			return nil, "", err
+		}
+	}
+
+	m, format, err = loader(filename)
+	if err != nil {
+		if errCfg != nil {
+			return nil, "", err
+		}
+		var err1 error
+		if m, format, err1 = Load(filename); err1 != nil {
+			return nil, "", err // retuen loader's err
+		}
+	}
+	if errCfg != nil {
+		b := m.Bounds()
+		if err = opt.CheckSize(b.Dx(), b.Dy(), ChannelsOf(m), DataTypeOf(m)); err != nil {
+			return nil, "", err
+		}
+	}
+	return
+}
+
+func LoadImageWithOptions(filename string, opt *DecodeOptions) (m *MemPImage, format string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return DecodeImageWithOptions(f, opt)
+}
+
+func LoadImageExWithOptions(filename string, loader Loader, opt *DecodeOptions) (m *MemPImage, format string, err error) {
+	x, format, err := LoadExWithOptions(filename, loader, opt)
+	if err != nil {
+		return nil, "", err
+	}
+	if m, _ = AsMemPImage(x); m == nil {
+		m = NewMemPImageFrom(x)
+	}
+	return m, format, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeWithOptions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeMemP(&buf, NewMemPImage(image.Rect(0, 0, 100, 50), 3, reflect.Uint16)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	for _, v := range []struct {
+		opt   *DecodeOptions
+		limit string
+	}{
+		{nil, ""},
+		{&DecodeOptions{}, ""},
+		{&DecodeOptions{MaxWidth: 100, MaxHeight: 50, MaxPixels: 5000, MaxBytes: 30000}, ""},
+		{&DecodeOptions{MaxWidth: 99}, "width"},
+		{&DecodeOptions{MaxHeight: 49}, "height"},
+		{&DecodeOptions{MaxPixels: 4999}, "pixels"},
+		{&DecodeOptions{MaxBytes: 29999}, "bytes"},
+	} {
+		m, _, err := DecodeImageWithOptions(bytes.NewReader(data), v.opt)
+		if v.limit == "" {
+			if err != nil {
+				t.Fatalf("%+v: %v", v.opt, err)
+			}
+			if m.Bounds() != image.Rect(0, 0, 100, 50) {
+				t.Fatalf("%+v: bad bounds %v", v.opt, m.Bounds())
+			}
+			continue
+		}
+		if e, ok := err.(*DecodeLimitError); !ok || e.Limit != v.limit {
+			t.Fatalf("%+v: expect %s limit error, got %v", v.opt, v.limit, err)
+		}
+	}
+}
+
+func TestLoadExWithOptions(t *testing.T) {
+	called := false
+	loader := func(filename string) (image.Image, string, error) {
+		called = true
+		return Load(filename)
+	}
+
+	_, _, err := LoadExWithOptions("./testdata/lena.jpg", loader, &DecodeOptions{MaxPixels: 1000})
+	if _, ok := err.(*DecodeLimitError); !ok {
+		t.Fatalf("expect *DecodeLimitError, got %v", err)
+	}
+	if called {
+		t.Fatal("loader should not be called")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"reflect"
+)
+
+// Raw MemP file format (Little Endian):
+//
+//	Magic      [4]byte // "MemP"
+//	HeaderSize uint32  // 32
+//	Width      int32
+//	Height     int32
+//	Channels   int32
+//	DataType   int32   // reflect.Kind
+//	Reserved   [8]byte
+//	Pix        []byte  // Height rows, Width*SizeofPixel(Channels, DataType) bytes per row
+const MemPHeaderSize = 32
+
+type memPHeader struct {
+	Magic      [4]byte
+	HeaderSize uint32
+	Width      int32
+	Height     int32
+	Channels   int32
+	DataType   int32
+	Reserved   [8]byte
+}
+
+func init() {
+	image.RegisterFormat("memp", MemPMagic, decodeMemP, decodeMemPConfig)
+	RegisterFormatInto("memp", MemPMagic, decodeMemPInto)
+}
+
+func readMemPHeader(r io.Reader) (hdr memPHeader, err error) {
+	if err = binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return
+	}
+	if string(hdr.Magic[:]) != MemPMagic {
+		err = errors.New("image: memp, bad magic")
+		return
+	}
+	if hdr.HeaderSize < MemPHeaderSize {
+		err = fmt.Errorf("image: memp, bad header size: %d", hdr.HeaderSize)
+		return
+	}
+	if hdr.Width < 0 || hdr.Height < 0 {
+		err = fmt.Errorf("image: memp, bad size: %dx%d", hdr.Width, hdr.Height)
+		return
+	}
+	if hdr.Channels <= 0 || hdr.Channels > maxDecodeChannels || SizeofKind(reflect.Kind(hdr.DataType)) == 0 {
+		err = fmt.Errorf("image: memp, bad pixel type: %d, %v", hdr.Channels, reflect.Kind(hdr.DataType))
+		return
+	}
+	if _, ok := pixBytes(int(hdr.Width), int(hdr.Height), int(hdr.Channels), reflect.Kind(hdr.DataType)); !ok {
+		err = fmt.Errorf("image: memp, image too big: %dx%d, %d, %v",
+			hdr.Width, hdr.Height, hdr.Channels, reflect.Kind(hdr.DataType),
+		)
+		return
+	}
+	if n := int64(hdr.HeaderSize) - MemPHeaderSize; n > 0 {
+		if _, err = io.CopyN(io.Discard, r, n); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ReadMemPHeader reads the raw MemP header, the rows start at headerSize.
+func ReadMemPHeader(r io.Reader) (cfg image.Config, headerSize int, err error) {
+	hdr, err := readMemPHeader(r)
+	if err != nil {
+		return image.Config{}, 0, err
+	}
+	cfg = image.Config{
+		ColorModel: ColorModel(int(hdr.Channels), reflect.Kind(hdr.DataType)),
+		Width:      int(hdr.Width),
+		Height:     int(hdr.Height),
+	}
+	return cfg, int(hdr.HeaderSize), nil
+}
+
+// WriteMemPHeader writes the raw MemP header, the rows must follow.
+func WriteMemPHeader(w io.Writer, width, height, channels int, dataType reflect.Kind) error {
+	hdr := memPHeader{
+		HeaderSize: MemPHeaderSize,
+		Width:      int32(width),
+		Height:     int32(height),
+		Channels:   int32(channels),
+		DataType:   int32(dataType),
+	}
+	copy(hdr.Magic[:], MemPMagic)
+	return binary.Write(w, binary.LittleEndian, &hdr)
+}
+
+func decodeMemPConfig(r io.Reader) (cfg image.Config, err error) {
+	cfg, _, err = ReadMemPHeader(r)
+	return
+}
+
+func decodeMemP(r io.Reader) (m image.Image, err error) {
+	hdr, err := readMemPHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	channels, dataType := int(hdr.Channels), reflect.Kind(hdr.DataType)
+	n, _ := pixBytes(int(hdr.Width), int(hdr.Height), channels, dataType)
+	pix, err := readPix(r, n)
+	if err != nil {
+		return nil, err
+	}
+	if !isLittleEndian {
+		PixSlice(pix).SwapEndian(dataType)
+	}
+	return newMemPImageFromPix(int(hdr.Width), int(hdr.Height), channels, dataType, pix), nil
+}
+
+// newMemPImageFromPix returns the image of the rows in pix.
+func newMemPImageFromPix(width, height, channels int, dataType reflect.Kind, pix []byte) *MemPImage {
+	return &MemPImage{
+		XMemPMagic: MemPMagic,
+		XRect:      image.Rect(0, 0, width, height),
+		XStride:    width * SizeofPixel(channels, dataType),
+		XChannels:  channels,
+		XDataType:  dataType,
+		XPix:       pix,
+	}
+}
+
+func decodeMemPInto(r io.Reader, dst *MemPImage) error {
+	hdr, err := readMemPHeader(r)
+	if err != nil {
+		return err
+	}
+	b := dst.Bounds()
+	if b.Dx() != int(hdr.Width) || b.Dy() != int(hdr.Height) {
+		return fmt.Errorf("image: memp, size mismatch: %dx%d != %dx%d",
+			hdr.Width, hdr.Height, b.Dx(), b.Dy(),
+		)
+	}
+	if dst.XChannels != int(hdr.Channels) || dst.XDataType != reflect.Kind(hdr.DataType) {
+		return fmt.Errorf("image: memp, pixel type mismatch: (%d, %v) != (%d, %v)",
+			hdr.Channels, reflect.Kind(hdr.DataType), dst.XChannels, dst.XDataType,
+		)
+	}
+	return readMemPRows(r, dst)
+}
+
+func readMemPRows(r io.Reader, p *MemPImage) error {
+	b := p.Bounds()
+	n := b.Dx() * SizeofPixel(p.XChannels, p.XDataType)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := p.XPix[p.PixOffset(b.Min.X, y):][:n]
+		if _, err := io.ReadFull(r, row); err != nil {
+			return err
+		}
+		if !isLittleEndian {
+			PixSlice(row).SwapEndian(p.XDataType)
+		}
+	}
+	return nil
+}
+
+// EncodeMemP writes the image m to w in the raw MemP format.
+func EncodeMemP(w io.Writer, m image.Image) error {
+	p, ok := AsMemPImage(m)
+	if !ok {
+		p = NewMemPImageFrom(m)
+	}
+
+	b := p.Bounds()
+	if err := WriteMemPHeader(w, b.Dx(), b.Dy(), p.XChannels, p.XDataType); err != nil {
+		return err
+	}
+
+	n := b.Dx() * SizeofPixel(p.XChannels, p.XDataType)
+	var buf []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := p.XPix[p.PixOffset(b.Min.X, y):][:n]
+		if !isLittleEndian {
+			buf = append(buf[:0], row...)
+			PixSlice(buf).SwapEndian(p.XDataType)
+			row = buf
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"image"
+	_ "image/png"
+	"reflect"
+	"testing"
+)
+
+func tNewPattern(r image.Rectangle, channels int, dataType reflect.Kind) *MemPImage {
+	m := NewMemPImage(r, channels, dataType)
+	for i := range m.XPix {
+		m.XPix[i] = byte(i*7 + i/13)
+	}
+	return m
+}
+
+func TestMemP_roundtrip(t *testing.T) {
+	m0 := tNewPattern(image.Rect(0, 0, 31, 17), 3, reflect.Uint16)
+
+	var buf bytes.Buffer
+	if err := EncodeMemP(&buf, m0); err != nil {
+		t.Fatal(err)
+	}
+
+	m1, format, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "memp" {
+		t.Fatalf("format: %q", format)
+	}
+	if p := m1.(*MemPImage); !bytes.Equal(p.XPix, m0.XPix) {
+		t.Fatal("pix mismatch")
+	}
+}
+
+func TestDecode_mempBadHeader(t *testing.T) {
+	for _, v := range []struct {
+		width, height, channels int
+		dataType                reflect.Kind
+	}{
+		{1 << 30, 1 << 30, 1 << 30, reflect.Uint8},
+		{1 << 30, 1 << 30, 1, reflect.Float64},
+		{1, 1, 1 << 13, reflect.Uint8},
+		{1 << 15, 1 << 15, 4, reflect.Uint8}, // the rows are missing
+	} {
+		var buf bytes.Buffer
+		if err := WriteMemPHeader(&buf, v.width, v.height, v.channels, v.dataType); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Decode(bytes.NewReader(buf.Bytes())); err == nil {
+			t.Fatalf("%+v: expect error", v)
+		}
+	}
+}
+
+func TestDecodeImageInto_memp(t *testing.T) {
+	m0 := tNewPattern(image.Rect(0, 0, 20, 10), 1, reflect.Float32)
+
+	var buf bytes.Buffer
+	if err := EncodeMemP(&buf, m0); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	big := NewMemPImage(image.Rect(0, 0, 64, 32), 1, reflect.Float32)
+	dst := big.SubImage(image.Rect(30, 20, 50, 30)).(*MemPImage)
+	if _, err := DecodeImageInto(dst, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			if a, b := m0.PixelAt(x, y), big.PixelAt(30+x, 20+y); !bytes.Equal(a, b) {
+				t.Fatalf("(%d,%d): %v != %v", x, y, a, b)
+			}
+		}
+	}
+
+	small := NewMemPImage(image.Rect(0, 0, 10, 10), 1, reflect.Float32)
+	if _, err := DecodeImageInto(small, bytes.NewReader(data)); err == nil {
+		t.Fatal("expect size mismatch error")
+	}
+}
+
+func TestLoadImageInto_png(t *testing.T) {
+	m0, _, err := LoadImage("./testdata/lena.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewMemPImage(m0.Bounds(), m0.XChannels, m0.XDataType)
+	format, err := LoadImageInto(dst, "./testdata/lena.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" {
+		t.Fatalf("format: %q", format)
+	}
+	if !bytes.Equal(dst.XPix, m0.XPix) {
+		t.Fatal("pix mismatch")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+)
+
+// ApplyOrientation returns m transformed by the EXIF orientation (1-8),
+// so that it is displayed upright.
+//
+// If orientation is 0 or 1, m is returned.
+func ApplyOrientation(m *MemPImage, orientation int) *MemPImage {
+	if orientation < 2 || orientation > 8 {
+		return m
+	}
+
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	r := image.Rect(0, 0, w, h)
+	if orientation >= 5 {
+		r = image.Rect(0, 0, h, w)
+	}
+	p := NewMemPImage(r, m.XChannels, m.XDataType)
+	n := SizeofPixel(m.XChannels, m.XDataType)
+
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontal
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertical
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 CW
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90 CCW
+				sx, sy = w-1-y, x
+			}
+			copy(
+				p.XPix[p.PixOffset(x, y):][:n],
+				m.XPix[m.PixOffset(b.Min.X+sx, b.Min.Y+sy):][:n],
+			)
+		}
+	}
+	return p
+}
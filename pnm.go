@@ -0,0 +1,172 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"reflect"
+)
+
+// Binary PNM file format:
+//
+//	Magic   "P5" (gray) or "P6" (RGB)
+//	Width   ASCII decimal
+//	Height  ASCII decimal
+//	MaxVal  ASCII decimal, 1 to 65535
+//	Pix     Height rows, Uint8 samples if MaxVal < 256, else big endian Uint16
+//
+// The header fields are separated by white space and "#" comments, a
+// single white space follows MaxVal. The samples are not scaled by MaxVal.
+
+type pnmHeader struct {
+	Width    int
+	Height   int
+	Channels int
+	DataType reflect.Kind
+}
+
+func init() {
+	image.RegisterFormat("pnm", "P5", decodePNM, decodePNMConfig)
+	image.RegisterFormat("pnm", "P6", decodePNM, decodePNMConfig)
+	RegisterFormatInto("pnm", "P5", decodePNMInto)
+	RegisterFormatInto("pnm", "P6", decodePNMInto)
+}
+
+func readPNMHeader(r io.ByteReader) (hdr pnmHeader, err error) {
+	var magic [2]byte
+	for i := range magic {
+		if magic[i], err = r.ReadByte(); err != nil {
+			return
+		}
+	}
+	switch string(magic[:]) {
+	case "P5":
+		hdr.Channels = 1
+	case "P6":
+		hdr.Channels = 3
+	default:
+		err = errors.New("image: pnm, bad magic")
+		return
+	}
+
+	// the single white space after MaxVal is consumed
+	var v [3]int
+	for i := range v {
+		if v[i], err = readPNMInt(r); err != nil {
+			return
+		}
+	}
+
+	hdr.Width, hdr.Height = v[0], v[1]
+	switch maxVal := v[2]; {
+	case maxVal < 1 || maxVal > 65535:
+		err = fmt.Errorf("image: pnm, bad maxval: %d", maxVal)
+		return
+	case maxVal < 256:
+		hdr.DataType = reflect.Uint8
+	default:
+		hdr.DataType = reflect.Uint16
+	}
+	if _, ok := pixBytes(hdr.Width, hdr.Height, hdr.Channels, hdr.DataType); !ok || hdr.Width == 0 || hdr.Height == 0 {
+		err = fmt.Errorf("image: pnm, bad size: %dx%d", hdr.Width, hdr.Height)
+	}
+	return
+}
+
+// readPNMInt skips the white space and the comments, then reads a
+// decimal number, the byte after it is consumed.
+func readPNMInt(r io.ByteReader) (v int, err error) {
+	c, err := r.ReadByte()
+	for err == nil && (isPNMSpace(c) || c == '#') {
+		if c == '#' {
+			for err == nil && c != '\n' && c != '\r' {
+				c, err = r.ReadByte()
+			}
+			continue
+		}
+		c, err = r.ReadByte()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for ; err == nil && c >= '0' && c <= '9'; n++ {
+		if v = v*10 + int(c-'0'); v > 1<<30 {
+			return 0, errors.New("image: pnm, number too big")
+		}
+		c, err = r.ReadByte()
+	}
+	if n == 0 || err != nil || !isPNMSpace(c) {
+		return 0, errors.New("image: pnm, bad header")
+	}
+	return v, nil
+}
+
+func isPNMSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func decodePNMConfig(r io.Reader) (cfg image.Config, err error) {
+	hdr, err := readPNMHeader(asByteReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	cfg = image.Config{
+		ColorModel: ColorModel(hdr.Channels, hdr.DataType),
+		Width:      hdr.Width,
+		Height:     hdr.Height,
+	}
+	return cfg, nil
+}
+
+func decodePNM(r io.Reader) (m image.Image, err error) {
+	br := asByteReader(r)
+	hdr, err := readPNMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := pixBytes(hdr.Width, hdr.Height, hdr.Channels, hdr.DataType)
+	pix, err := readPix(br, n)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.DataType == reflect.Uint16 && isLittleEndian {
+		PixSlice(pix).SwapEndian(hdr.DataType)
+	}
+	return newMemPImageFromPix(hdr.Width, hdr.Height, hdr.Channels, hdr.DataType, pix), nil
+}
+
+// decodePNMInto converts the rows of another pixel type than dst by a
+// one row buffer.
+func decodePNMInto(r io.Reader, dst *MemPImage) error {
+	br := asByteReader(r)
+	hdr, err := readPNMHeader(br)
+	if err != nil {
+		return err
+	}
+	b := dst.Bounds()
+	if b.Dx() != hdr.Width || b.Dy() != hdr.Height {
+		return fmt.Errorf("image: pnm, size mismatch: %dx%d != %dx%d",
+			hdr.Width, hdr.Height, b.Dx(), b.Dy(),
+		)
+	}
+	return readPNMRows(br, dst, hdr)
+}
+
+func readPNMRows(r io.Reader, dst *MemPImage, hdr pnmHeader) error {
+	return readRowsInto(dst, hdr.Channels, hdr.DataType, func(y int, row []byte) error {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return err
+		}
+		if hdr.DataType == reflect.Uint16 && isLittleEndian {
+			PixSlice(row).SwapEndian(hdr.DataType)
+		}
+		return nil
+	})
+}
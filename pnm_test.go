@@ -0,0 +1,105 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeImageInto_pnm(t *testing.T) {
+	gray := []byte("P5\n# a comment\n3 2\n255\n")
+	gray = append(gray, 1, 2, 3, 4, 5, 6)
+	rgb16 := []byte("P6 2 1 65535\t")
+	rgb16 = append(rgb16, 0, 1, 0, 2, 0, 3, 1, 0, 2, 0, 3, 0)
+
+	for _, tt := range []struct {
+		data     []byte
+		size     image.Point
+		channels int
+		dataType reflect.Kind
+		values   []float64
+	}{
+		{gray, image.Pt(3, 2), 1, reflect.Uint8, []float64{1, 2, 3, 4, 5, 6}},
+		{rgb16, image.Pt(2, 1), 3, reflect.Uint16, []float64{1, 2, 3, 256, 512, 768}},
+	} {
+		cfg, format, err := DecodeConfig(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != "pnm" || cfg.Width != tt.size.X || cfg.Height != tt.size.Y {
+			t.Fatalf("bad config: %q, %+v", format, cfg)
+		}
+
+		m, _, err := Decode(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := m.(*MemPImage)
+		if p.XChannels != tt.channels || p.XDataType != tt.dataType {
+			t.Fatalf("bad pixel type: %d, %v", p.XChannels, p.XDataType)
+		}
+		for i, v := range tt.values {
+			if x := PixSlice(p.XPix).Value(i, p.XDataType); x != v {
+				t.Fatalf("%d: %v != %v", i, x, v)
+			}
+		}
+
+		// the rows are read into a SubImage
+		big := NewMemPImage(image.Rect(0, 0, 10, 10), tt.channels, tt.dataType)
+		dst := big.SubImage(image.Rectangle{image.Pt(4, 5), image.Pt(4, 5).Add(tt.size)}).(*MemPImage)
+		if _, err := DecodeImageInto(dst, bytes.NewReader(tt.data)); err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < tt.size.Y; y++ {
+			for x := 0; x < tt.size.X; x++ {
+				if a, b := p.PixelAt(x, y), big.PixelAt(4+x, 5+y); !bytes.Equal(a, b) {
+					t.Fatalf("(%d,%d): %v != %v", x, y, a, b)
+				}
+			}
+		}
+
+		// the rows of another pixel type are converted
+		want := NewMemPImage(p.Bounds(), 4, reflect.Float32)
+		if err := copyToMemPImage(want, p); err != nil {
+			t.Fatal(err)
+		}
+		conv := NewMemPImage(p.Bounds(), 4, reflect.Float32)
+		if _, err := DecodeImageInto(conv, bytes.NewReader(tt.data)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(conv.XPix, want.XPix) {
+			t.Fatal("converted pix mismatch")
+		}
+
+		if _, err := DecodeImageInto(dst, bytes.NewReader(tt.data[:len(tt.data)-1])); err == nil {
+			t.Fatal("expect truncated error")
+		}
+	}
+
+	for _, data := range []string{"P5 3 2 0\n", "P5 3 2 70000\n", "P5 3 x 255\n", "P5 3 99999999999 255\n"} {
+		if _, _, err := DecodeConfig(bytes.NewReader([]byte(data))); err == nil {
+			t.Fatalf("%q: expect error", data)
+		}
+	}
+}
+
+func TestDecode_pnmBadSize(t *testing.T) {
+	for _, data := range []string{
+		"P5 1073741824 1073741824 255\n",
+		"P6 1073741824 1073741824 65535\n",
+		"P5 0 2 255\n",
+		"P5 40000 40000 255\n", // the rows are missing
+	} {
+		if _, _, err := image.Decode(bytes.NewReader([]byte(data))); err == nil {
+			t.Fatalf("%q: expect error", data)
+		}
+		if _, _, err := Decode(bytes.NewReader([]byte(data))); err == nil {
+			t.Fatalf("%q: expect error", data)
+		}
+	}
+}
@@ -5,9 +5,13 @@
 package image
 
 import (
+	"bytes"
+	"fmt"
 	"image"
 	"io"
+	"io/ioutil"
 	"os"
+	"reflect"
 )
 
 type LoadConfiger func(filename string) (cfg image.Config, format string, err error)
@@ -30,6 +34,124 @@ func DecodeImage(r io.Reader) (m *MemPImage, format string, err error) {
 	return
 }
 
+// DecodeImageInto decodes an image into the preallocated dst.
+//
+// The decoded image must have the same size as dst, dst can be a SubImage
+// of a bigger MemPImage. Formats registered by RegisterFormatInto write the
+// rows into dst directly:
+//
+//	memp: the raw MemP format, of the dst pixel type
+//	pnm:  the binary PGM (P5) and PPM (P6)
+//	tiff: the uncompressed strips, read in memory first if r is not
+//	      an io.ReaderAt and io.Seeker
+//
+// The pnm and tiff rows of another pixel type are converted to dst. Other
+// formats, and the other tiff layouts, are decoded by image.Decode and then
+// copied, so they do not save memory.
+func DecodeImageInto(dst *MemPImage, r io.Reader) (format string, err error) {
+	ra := sectionReaderAt(r)
+	rr := asReader(r)
+	if f := sniffInto(rr); f.decodeInto != nil {
+		var fr io.Reader = rr
+		if ra != nil {
+			fr = readerAt{rr, ra}
+		}
+		if err = f.decodeInto(fr, dst); err != nil {
+			return "", err
+		}
+		return f.name, nil
+	}
+	return decodeCopyInto(dst, rr)
+}
+
+// decodeCopyInto decodes r by image.Decode, then copies it into dst.
+func decodeCopyInto(dst *MemPImage, r io.Reader) (format string, err error) {
+	x, format, err := image.Decode(r)
+	if err != nil {
+		return "", err
+	}
+	if err = copyToMemPImage(dst, x); err != nil {
+		return "", err
+	}
+	return format, nil
+}
+
+// readRowsInto reads the rows of dst by readRow, y is from 0. The rows of
+// another pixel type than dst are read into a one row buffer, then
+// converted.
+func readRowsInto(dst *MemPImage, channels int, dataType reflect.Kind, readRow func(y int, row []byte) error) error {
+	b := dst.Bounds()
+	if b.Empty() {
+		return nil
+	}
+
+	var line *MemPImage
+	if dst.XChannels != channels || dst.XDataType != dataType {
+		line = NewMemPImage(image.Rect(0, 0, b.Dx(), 1), channels, dataType)
+	}
+	n := b.Dx() * SizeofPixel(channels, dataType)
+	for y := 0; y < b.Dy(); y++ {
+		if line == nil {
+			if err := readRow(y, dst.XPix[dst.PixOffset(b.Min.X, b.Min.Y+y):][:n]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := readRow(y, line.XPix); err != nil {
+			return err
+		}
+		r := image.Rect(b.Min.X, b.Min.Y+y, b.Max.X, b.Min.Y+y+1)
+		if err := copyToMemPImage(dst.SubImage(r).(*MemPImage), line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyToMemPImage(dst *MemPImage, m image.Image) error {
+	b0, b1 := dst.Bounds(), m.Bounds()
+	if b0.Dx() != b1.Dx() || b0.Dy() != b1.Dy() {
+		return fmt.Errorf("image: DecodeImageInto, size mismatch: %v != %v", b1.Size(), b0.Size())
+	}
+
+	if p, ok := AsMemPImage(m); ok && p.XChannels == dst.XChannels && p.XDataType == dst.XDataType {
+		n := b0.Dx() * SizeofPixel(dst.XChannels, dst.XDataType)
+		for y := 0; y < b0.Dy(); y++ {
+			copy(
+				dst.XPix[dst.PixOffset(b0.Min.X, b0.Min.Y+y):][:n],
+				p.XPix[p.PixOffset(b1.Min.X, b1.Min.Y+y):][:n],
+			)
+		}
+		return nil
+	}
+
+	// the rows are converted as NewMemPImageFrom, without a copy of m,
+	// which copies the rows from x = 0
+	sub, ok := m.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok || b1.Min.X != 0 {
+		for y := 0; y < b0.Dy(); y++ {
+			for x := 0; x < b0.Dx(); x++ {
+				dst.Set(b0.Min.X+x, b0.Min.Y+y, m.At(b1.Min.X+x, b1.Min.Y+y))
+			}
+		}
+		return nil
+	}
+	for y := 0; y < b0.Dy(); y++ {
+		line := NewMemPImageFrom(sub.SubImage(image.Rect(b1.Min.X, b1.Min.Y+y, b1.Max.X, b1.Min.Y+y+1)))
+		if line.XChannels == dst.XChannels && line.XDataType == dst.XDataType {
+			copy(dst.XPix[dst.PixOffset(b0.Min.X, b0.Min.Y+y):], line.XPix[:b0.Dx()*SizeofPixel(dst.XChannels, dst.XDataType)])
+			continue
+		}
+		lb := line.Bounds()
+		for x := 0; x < b0.Dx(); x++ {
+			dst.Set(b0.Min.X+x, b0.Min.Y+y, line.At(lb.Min.X+x, lb.Min.Y))
+		}
+	}
+	return nil
+}
+
 func LoadConfig(filename string) (cfg image.Config, format string, err error) {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -107,3 +229,55 @@ func LoadImageEx(filename string, loader Loader) (m *MemPImage, format string, e
 	}
 	return LoadImage(filename)
 }
+
+func LoadImageInto(dst *MemPImage, filename string) (format string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return DecodeImageInto(dst, f)
+}
+
+// DecodeWithExif decodes an image and its EXIF, x is nil if there is no EXIF.
+func DecodeWithExif(r io.Reader) (m image.Image, x *Exif, format string, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return decodeWithExif(data)
+}
+
+func decodeWithExif(data []byte) (m image.Image, x *Exif, format string, err error) {
+	m, format, err = Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	x, _ = parseExif(data) // ignore bad exif
+	return
+}
+
+func LoadWithExif(filename string) (m image.Image, x *Exif, format string, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return decodeWithExif(data)
+}
+
+// LoadImageWithExif loads an image and its EXIF, if autoOrient is true,
+// the EXIF orientation is applied to the returned image.
+func LoadImageWithExif(filename string, autoOrient bool) (m *MemPImage, x *Exif, format string, err error) {
+	xm, x, format, err := LoadWithExif(filename)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if m, _ = AsMemPImage(xm); m == nil {
+		m = NewMemPImageFrom(xm)
+	}
+	if autoOrient && x != nil {
+		m = ApplyOrientation(m, x.Orientation)
+	}
+	return m, x, format, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"context"
+	"image"
+	"io"
+	"os"
+)
+
+type LoadConfigerContext func(ctx context.Context, filename string) (cfg image.Config, format string, err error)
+type LoaderContext func(ctx context.Context, filename string) (m image.Image, format string, err error)
+
+// contextReader fails the next Read once ctx is done,
+// so a long decode stops between two reads.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (p *contextReader) Read(b []byte) (n int, err error) {
+	if err = p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return p.r.Read(b)
+}
+
+func DecodeConfigContext(ctx context.Context, r io.Reader) (cfg image.Config, format string, err error) {
+	if err = ctx.Err(); err != nil {
+		return image.Config{}, "", err
+	}
+	return DecodeConfig(&contextReader{ctx, r})
+}
+
+func DecodeContext(ctx context.Context, r io.Reader) (m image.Image, format string, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	if m, format, err = Decode(&contextReader{ctx, r}); err != nil {
+		return nil, "", err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	return
+}
+
+func DecodeImageContext(ctx context.Context, r io.Reader) (m *MemPImage, format string, err error) {
+	x, format, err := DecodeContext(ctx, r)
+	if err != nil {
+		return nil, "", err
+	}
+	if m, _ = AsMemPImage(x); m == nil {
+		m = NewMemPImageFrom(x)
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	return m, format, nil
+}
+
+func LoadConfigContext(ctx context.Context, filename string) (cfg image.Config, format string, err error) {
+	if err = ctx.Err(); err != nil {
+		return image.Config{}, "", err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	defer f.Close()
+	return DecodeConfigContext(ctx, f)
+}
+
+func LoadConfigExContext(ctx context.Context, filename string, loader LoadConfigerContext) (cfg image.Config, format string, err error) {
+	if loader != nil {
+		cfg, format, err = loader(ctx, filename)
+		if err != nil {
+			if ctx.Err() != nil {
+				return image.Config{}, "", err
+			}
+			var err1 error
+			if cfg, format, err1 = LoadConfigContext(ctx, filename); err1 != nil {
+				return image.Config{}, "", err // retuen loader's err
+			}
+		}
+		return
+	}
+	return LoadConfigContext(ctx, filename)
+}
+
+func LoadContext(ctx context.Context, filename string) (m image.Image, format string, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return DecodeContext(ctx, f)
+}
+
+func LoadExContext(ctx context.Context, filename string, loader LoaderContext) (m image.Image, format string, err error) {
+	if loader != nil {
+		m, format, err = loader(ctx, filename)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, "", err
+			}
+			var err1 error
+			if m, format, err1 = LoadContext(ctx, filename); err1 != nil {
+				return nil, "", err // retuen loader's err
+			}
+		}
+		return
+	}
+	return LoadContext(ctx, filename)
+}
+
+func LoadImageContext(ctx context.Context, filename string) (m *MemPImage, format string, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return DecodeImageContext(ctx, f)
+}
+
+func LoadImageExContext(ctx context.Context, filename string, loader LoaderContext) (m *MemPImage, format string, err error) {
+	if loader != nil {
+		x, format, err := loader(ctx, filename)
+		if err != nil {
+			return nil, "", err
+		}
+		if m, _ = AsMemPImage(x); m == nil {
+			m = NewMemPImageFrom(x)
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, "", err
+		}
+		return m, format, nil
+	}
+	return LoadImageContext(ctx, filename)
+}
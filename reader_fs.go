@@ -0,0 +1,48 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"io/fs"
+)
+
+func LoadConfigFS(fsys fs.FS, name string) (cfg image.Config, format string, err error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	defer f.Close()
+	return DecodeConfig(f)
+}
+
+func LoadFS(fsys fs.FS, name string) (m image.Image, format string, err error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+func LoadImageFS(fsys fs.FS, name string) (m *MemPImage, format string, err error) {
+	x, format, err := LoadFS(fsys, name)
+	if err != nil {
+		return nil, "", err
+	}
+	if m, _ = AsMemPImage(x); m == nil {
+		m = NewMemPImageFrom(x)
+	}
+	return m, format, nil
+}
+
+func LoadImageIntoFS(dst *MemPImage, fsys fs.FS, name string) (format string, err error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return DecodeImageInto(dst, f)
+}
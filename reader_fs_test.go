@@ -0,0 +1,65 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadImageFS(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/lena.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"lena.png": &fstest.MapFile{Data: data},
+	}
+
+	cfg, format, err := LoadConfigFS(fsys, "lena.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" || cfg.Width != 512 || cfg.Height != 512 {
+		t.Fatalf("bad config: %v, %v", format, cfg)
+	}
+
+	m, _, err := LoadImageFS(fsys, "lena.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != image.Rect(0, 0, 512, 512) {
+		t.Fatalf("bad bounds: %v", m.Bounds())
+	}
+
+	if _, _, err := LoadFS(fsys, "missing.png"); err == nil {
+		t.Fatal("expect error")
+	}
+}
+
+func TestDecodeImageContext_canceled(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeMemP(&buf, NewMemPImage(image.Rect(0, 0, 8, 8), 1, reflect.Uint8)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, _, err := DecodeImageContext(ctx, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if _, _, err := DecodeImageContext(ctx, bytes.NewReader(buf.Bytes())); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	if _, _, err := LoadImageContext(ctx, "./testdata/lena.png"); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+}
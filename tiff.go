@@ -0,0 +1,329 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+)
+
+// The TIFF files decoded by decodeTIFFInto have the first IFD with:
+//
+//	Compression          none
+//	Photometric          BlackIsZero or RGB
+//	PlanarConfiguration  chunky, or one sample per pixel
+//	BitsPerSample        8, 16, 32 or 64, the same for every sample
+//	SampleFormat         unsigned, signed or float
+//	StripOffsets         strips, not tiles
+//
+// The other files are decoded by image.Decode, which needs a registered
+// TIFF decoder, like golang.org/x/image/tiff.
+
+const (
+	tiffTagWidth           = 256
+	tiffTagHeight          = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagPlanarConfig    = 284
+	tiffTagPredictor       = 317
+	tiffTagTileWidth       = 322
+	tiffTagSampleFormat    = 339
+)
+
+const (
+	tiffMaxEntries = 1 << 12
+	tiffMaxSamples = 1 << 12
+)
+
+// errTIFFLayout is a valid TIFF file not decoded by decodeTIFFInto.
+var errTIFFLayout = errors.New("image: tiff, unsupported layout")
+
+type tiffEntry struct {
+	Type  uint16
+	Count uint32
+	Value [4]byte
+}
+
+type tiffStrips struct {
+	Width, Height int
+	Channels      int
+	DataType      reflect.Kind
+	Order         binary.ByteOrder
+	RowsPerStrip  int
+	Offsets       []int64
+	ByteCounts    []int64
+}
+
+func init() {
+	RegisterFormatInto("tiff", "II*\x00", decodeTIFFInto)
+	RegisterFormatInto("tiff", "MM\x00*", decodeTIFFInto)
+}
+
+func decodeTIFFInto(r io.Reader, dst *MemPImage) error {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		ra = bytes.NewReader(data)
+	}
+
+	p, err := readTIFFStrips(ra)
+	if err == errTIFFLayout {
+		_, err = decodeCopyInto(dst, io.NewSectionReader(ra, 0, math.MaxInt64))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	b := dst.Bounds()
+	if b.Dx() != p.Width || b.Dy() != p.Height {
+		return fmt.Errorf("image: tiff, size mismatch: %dx%d != %dx%d",
+			p.Width, p.Height, b.Dx(), b.Dy(),
+		)
+	}
+	swap := (p.Order == binary.BigEndian) == isLittleEndian
+	rowBytes := int64(p.Width * SizeofPixel(p.Channels, p.DataType))
+	return readRowsInto(dst, p.Channels, p.DataType, func(y int, row []byte) error {
+		i := y / p.RowsPerStrip
+		off := p.Offsets[i] + int64(y%p.RowsPerStrip)*rowBytes
+		if _, err := ra.ReadAt(row, off); err != nil {
+			return fmt.Errorf("image: tiff, read strip %d: %v", i, err)
+		}
+		if swap {
+			PixSlice(row).SwapEndian(p.DataType)
+		}
+		return nil
+	})
+}
+
+// readTIFFStrips reads the first IFD, it returns errTIFFLayout for the
+// files not in uncompressed strips.
+func readTIFFStrips(ra io.ReaderAt) (p *tiffStrips, err error) {
+	var hdr [8]byte
+	if _, err = ra.ReadAt(hdr[:], 0); err != nil {
+		return nil, err
+	}
+	p = new(tiffStrips)
+	switch string(hdr[:4]) {
+	case "II*\x00":
+		p.Order = binary.LittleEndian
+	case "MM\x00*":
+		p.Order = binary.BigEndian
+	default:
+		return nil, errors.New("image: tiff, bad magic")
+	}
+
+	ifd := int64(p.Order.Uint32(hdr[4:]))
+	var buf [2]byte
+	if _, err = ra.ReadAt(buf[:], ifd); err != nil {
+		return nil, fmt.Errorf("image: tiff, read IFD: %v", err)
+	}
+	n := int(p.Order.Uint16(buf[:]))
+	if n > tiffMaxEntries {
+		return nil, fmt.Errorf("image: tiff, too many IFD entries: %d", n)
+	}
+	data := make([]byte, n*12)
+	if _, err = ra.ReadAt(data, ifd+2); err != nil {
+		return nil, fmt.Errorf("image: tiff, read IFD: %v", err)
+	}
+	entries := make(map[uint16]tiffEntry, n)
+	for i := 0; i < n; i++ {
+		v := data[i*12:]
+		e := tiffEntry{Type: p.Order.Uint16(v[2:]), Count: p.Order.Uint32(v[4:])}
+		copy(e.Value[:], v[8:12])
+		entries[p.Order.Uint16(v)] = e
+	}
+
+	// the scalars, then the arrays of the size known from them
+	scalar := func(tag uint16, def int64) (int64, error) {
+		if _, ok := entries[tag]; !ok {
+			return def, nil
+		}
+		v, err := readTIFFValues(ra, p.Order, entries[tag], 1)
+		if err != nil {
+			return 0, err
+		}
+		return v[0], nil
+	}
+	var v [7]int64
+	for i, x := range []struct {
+		tag uint16
+		def int64
+	}{
+		{tiffTagWidth, 0},
+		{tiffTagHeight, 0},
+		{tiffTagSamplesPerPixel, 1},
+		{tiffTagCompression, 1},
+		{tiffTagPhotometric, -1},
+		{tiffTagPlanarConfig, 1},
+		{tiffTagPredictor, 1},
+	} {
+		if v[i], err = scalar(x.tag, x.def); err != nil {
+			return nil, err
+		}
+	}
+	width, height, spp := v[0], v[1], v[2]
+	if width <= 0 || height <= 0 || width > math.MaxInt32 || height > math.MaxInt32 {
+		return nil, fmt.Errorf("image: tiff, bad size: %dx%d", width, height)
+	}
+	if spp <= 0 || spp > tiffMaxSamples {
+		return nil, fmt.Errorf("image: tiff, bad samples per pixel: %d", spp)
+	}
+	if _, ok := entries[tiffTagTileWidth]; ok {
+		return nil, errTIFFLayout
+	}
+	if v[3] != 1 || (v[4] != 1 && v[4] != 2) || (v[5] != 1 && spp != 1) || v[6] != 1 {
+		return nil, errTIFFLayout
+	}
+	p.Width, p.Height, p.Channels = int(width), int(height), int(spp)
+
+	bits, err := readTIFFSamples(ra, p.Order, entries, tiffTagBitsPerSample, 1, spp)
+	if err != nil {
+		return nil, err
+	}
+	format, err := readTIFFSamples(ra, p.Order, entries, tiffTagSampleFormat, 1, spp)
+	if err != nil {
+		return nil, err
+	}
+	if p.DataType = tiffDataType(bits, format); p.DataType == reflect.Invalid {
+		return nil, errTIFFLayout
+	}
+
+	rps, err := scalar(tiffTagRowsPerStrip, height)
+	if err != nil {
+		return nil, err
+	}
+	if rps <= 0 || rps > height {
+		rps = height
+	}
+	p.RowsPerStrip = int(rps)
+
+	strips := (height + rps - 1) / rps
+	if p.Offsets, err = readTIFFArray(ra, p.Order, entries, tiffTagStripOffsets, strips); err != nil {
+		return nil, err
+	}
+	if p.ByteCounts, err = readTIFFArray(ra, p.Order, entries, tiffTagStripByteCounts, strips); err != nil {
+		return nil, err
+	}
+	rowBytes := width * int64(SizeofPixel(p.Channels, p.DataType))
+	for i, n := range p.ByteCounts {
+		rows := minInt64(rps, height-int64(i)*rps)
+		if n < rows*rowBytes {
+			return nil, fmt.Errorf("image: tiff, strip %d too short: %d < %d", i, n, rows*rowBytes)
+		}
+	}
+	return p, nil
+}
+
+// readTIFFSamples reads the per sample value, or the default.
+func readTIFFSamples(ra io.ReaderAt, order binary.ByteOrder, entries map[uint16]tiffEntry, tag uint16, def, spp int64) ([]int64, error) {
+	e, ok := entries[tag]
+	if !ok {
+		return []int64{def}, nil
+	}
+	if int64(e.Count) != 1 && int64(e.Count) != spp {
+		return nil, fmt.Errorf("image: tiff, bad count of tag %d: %d", tag, e.Count)
+	}
+	return readTIFFValues(ra, order, e, spp)
+}
+
+// readTIFFArray reads the n values of the tag.
+func readTIFFArray(ra io.ReaderAt, order binary.ByteOrder, entries map[uint16]tiffEntry, tag uint16, n int64) ([]int64, error) {
+	e, ok := entries[tag]
+	if !ok || int64(e.Count) != n {
+		return nil, fmt.Errorf("image: tiff, bad tag %d", tag)
+	}
+	return readTIFFValues(ra, order, e, n)
+}
+
+// readTIFFValues reads the BYTE, SHORT or LONG values of e, at most max.
+func readTIFFValues(ra io.ReaderAt, order binary.ByteOrder, e tiffEntry, max int64) ([]int64, error) {
+	size := 0
+	switch e.Type {
+	case 1: // BYTE
+		size = 1
+	case 3: // SHORT
+		size = 2
+	case 4: // LONG
+		size = 4
+	default:
+		return nil, fmt.Errorf("image: tiff, bad type: %d", e.Type)
+	}
+	if e.Count == 0 || int64(e.Count) > max {
+		return nil, fmt.Errorf("image: tiff, bad count: %d", e.Count)
+	}
+
+	// ReadAll only allocates the data in the file, not a crafted count
+	data := e.Value[:]
+	if n := int64(e.Count) * int64(size); n > 4 {
+		var err error
+		data, err = ioutil.ReadAll(io.NewSectionReader(ra, int64(order.Uint32(e.Value[:])), n))
+		if err != nil {
+			return nil, fmt.Errorf("image: tiff, read values: %v", err)
+		}
+		if int64(len(data)) != n {
+			return nil, fmt.Errorf("image: tiff, read values: %v", io.ErrUnexpectedEOF)
+		}
+	}
+	v := make([]int64, e.Count)
+	for i := range v {
+		switch size {
+		case 1:
+			v[i] = int64(data[i])
+		case 2:
+			v[i] = int64(order.Uint16(data[i*2:]))
+		case 4:
+			v[i] = int64(order.Uint32(data[i*4:]))
+		}
+	}
+	return v, nil
+}
+
+// tiffDataType returns the data type of the samples, or reflect.Invalid.
+func tiffDataType(bits, format []int64) reflect.Kind {
+	for _, v := range bits {
+		if v != bits[0] {
+			return reflect.Invalid
+		}
+	}
+	for _, v := range format {
+		if v != format[0] {
+			return reflect.Invalid
+		}
+	}
+
+	kinds := map[int64][3]reflect.Kind{
+		8:  {reflect.Uint8, reflect.Int8, reflect.Invalid},
+		16: {reflect.Uint16, reflect.Int16, reflect.Invalid},
+		32: {reflect.Uint32, reflect.Int32, reflect.Float32},
+		64: {reflect.Uint64, reflect.Int64, reflect.Float64},
+	}
+	k, ok := kinds[bits[0]]
+	if !ok || format[0] < 1 || format[0] > 3 {
+		return reflect.Invalid
+	}
+	return k[format[0]-1]
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
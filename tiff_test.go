@@ -0,0 +1,175 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// tEncodeTIFF writes the uncompressed strips of m, a 2 samples per pixel
+// image of 16 bits, then the IFD.
+func tEncodeTIFF(order binary.ByteOrder, m *MemPImage, rowsPerStrip int, sampleFormat uint16) []byte {
+	b := m.Bounds()
+	rowBytes := b.Dx() * SizeofPixel(m.XChannels, m.XDataType)
+
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II*\x00")
+	} else {
+		buf.WriteString("MM\x00*")
+	}
+	binary.Write(&buf, order, uint32(0)) // IFD offset
+
+	var offsets, counts []uint32
+	for y := 0; y < b.Dy(); y += rowsPerStrip {
+		offsets = append(offsets, uint32(buf.Len()))
+		n := 0
+		for i := y; i < y+rowsPerStrip && i < b.Dy(); i++ {
+			row := append([]byte(nil), m.XPix[m.PixOffset(b.Min.X, b.Min.Y+i):][:rowBytes]...)
+			if (order == binary.BigEndian) == isLittleEndian {
+				PixSlice(row).SwapEndian(m.XDataType)
+			}
+			buf.Write(row)
+			n += rowBytes
+		}
+		counts = append(counts, uint32(n))
+	}
+	arrays := buf.Len()
+	binary.Write(&buf, order, offsets)
+	binary.Write(&buf, order, counts)
+
+	ifd := buf.Len()
+	data := buf.Bytes()
+	order.PutUint32(data[4:], uint32(ifd))
+
+	short := func(v ...uint16) [4]byte {
+		var x [4]byte
+		for i, s := range v {
+			order.PutUint16(x[i*2:], s)
+		}
+		return x
+	}
+	long := func(v uint32) [4]byte {
+		var x [4]byte
+		order.PutUint32(x[:], v)
+		return x
+	}
+	entries := []struct {
+		Tag, Type uint16
+		Count     uint32
+		Value     [4]byte
+	}{
+		{tiffTagWidth, 4, 1, long(uint32(b.Dx()))},
+		{tiffTagHeight, 4, 1, long(uint32(b.Dy()))},
+		{tiffTagBitsPerSample, 3, 2, short(16, 16)},
+		{tiffTagCompression, 3, 1, short(1)},
+		{tiffTagPhotometric, 3, 1, short(1)},
+		{tiffTagStripOffsets, 4, uint32(len(offsets)), long(uint32(arrays))},
+		{tiffTagSamplesPerPixel, 3, 1, short(2)},
+		{tiffTagRowsPerStrip, 4, 1, long(uint32(rowsPerStrip))},
+		{tiffTagStripByteCounts, 4, uint32(len(counts)), long(uint32(arrays + 4*len(offsets)))},
+		{tiffTagSampleFormat, 3, 2, short(sampleFormat, sampleFormat)},
+	}
+	binary.Write(&buf, order, uint16(len(entries)))
+	binary.Write(&buf, order, entries)
+	binary.Write(&buf, order, uint32(0))
+	return buf.Bytes()
+}
+
+func TestDecodeImageInto_tiff(t *testing.T) {
+	m0 := tNewPattern(image.Rect(0, 0, 23, 11), 2, reflect.Int16)
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := tEncodeTIFF(order, m0, 3, 2)
+
+		// the rows are read into a SubImage
+		big := NewMemPImage(image.Rect(0, 0, 40, 30), 2, reflect.Int16)
+		dst := big.SubImage(image.Rect(10, 5, 33, 16)).(*MemPImage)
+		format, err := DecodeImageInto(dst, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != "tiff" {
+			t.Fatalf("format: %q", format)
+		}
+		for y := 0; y < 11; y++ {
+			for x := 0; x < 23; x++ {
+				if a, b := m0.PixelAt(x, y), big.PixelAt(10+x, 5+y); !bytes.Equal(a, b) {
+					t.Fatalf("%v (%d,%d): %v != %v", order, x, y, a, b)
+				}
+			}
+		}
+
+		// the input without random access
+		dst = NewMemPImage(m0.Bounds(), 2, reflect.Int16)
+		if _, err := DecodeImageInto(dst, io.MultiReader(bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dst.XPix, m0.XPix) {
+			t.Fatalf("%v: pix mismatch", order)
+		}
+
+		// the rows of another pixel type are converted
+		want := NewMemPImage(m0.Bounds(), 3, reflect.Float32)
+		if err := copyToMemPImage(want, m0); err != nil {
+			t.Fatal(err)
+		}
+		dst = NewMemPImage(m0.Bounds(), 3, reflect.Float32)
+		if _, err := DecodeImageInto(dst, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dst.XPix, want.XPix) {
+			t.Fatalf("%v: converted pix mismatch", order)
+		}
+
+		// a strip is missing
+		if _, err := DecodeImageInto(dst, bytes.NewReader(data[:100])); err == nil {
+			t.Fatalf("%v: expect error", order)
+		}
+		small := NewMemPImage(image.Rect(0, 0, 23, 10), 2, reflect.Int16)
+		if _, err := DecodeImageInto(small, bytes.NewReader(data)); err == nil {
+			t.Fatalf("%v: expect size mismatch error", order)
+		}
+	}
+}
+
+func TestDecodeImageInto_tiffDecode(t *testing.T) {
+	m0 := image.NewGray16(image.Rect(0, 0, 30, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			m0.SetGray16(x, y, color.Gray16{Y: uint16(x*2000 + y*7)})
+		}
+	}
+	want := NewMemPImageFrom(m0)
+
+	// the uncompressed strips are streamed, the compressed file is decoded
+	for _, opt := range []*tiff.Options{
+		{Compression: tiff.Uncompressed},
+		{Compression: tiff.Deflate},
+	} {
+		var buf bytes.Buffer
+		if err := tiff.Encode(&buf, m0, opt); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readTIFFStrips(bytes.NewReader(buf.Bytes())); (err == nil) != (opt.Compression == tiff.Uncompressed) {
+			t.Fatalf("%+v: bad layout: %v", opt, err)
+		}
+		dst := NewMemPImage(m0.Bounds(), 1, reflect.Uint16)
+		if _, err := DecodeImageInto(dst, bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dst.XPix, want.XPix) {
+			t.Fatalf("%+v: pix mismatch", opt)
+		}
+	}
+}
@@ -31,7 +31,7 @@ func Encode(m image.Image, encoder Encoder) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-// Save image, if encoder is nil, only support gif/jpeg/png format.
+// Save image, if encoder is nil, only support gif/jpeg/png/memp format.
 func Save(filename string, m image.Image, encoder Encoder) error {
 	f, err := os.Create(filename)
 	if err != nil {
@@ -39,20 +39,28 @@ func Save(filename string, m image.Image, encoder Encoder) error {
 	}
 	defer f.Close()
 
+	return encodeFile(f, filename, m, encoder)
+}
+
+// encodeFile encodes m to w with encoder, or with the format of the
+// filename extension if encoder is nil.
+func encodeFile(w io.Writer, filename string, m image.Image, encoder Encoder) error {
 	if encoder != nil {
-		return encoder(f, m)
+		return encoder(w, m)
 	}
 
 	ext := strings.ToLower(filepath.Ext(filename))
 	switch {
 	case strings.HasSuffix(ext, ".gif"):
-		return gif.Encode(f, m, nil)
+		return gif.Encode(w, m, nil)
 	case strings.HasSuffix(ext, ".jpeg"):
-		return jpeg.Encode(f, m, nil)
+		return jpeg.Encode(w, m, nil)
 	case strings.HasSuffix(ext, ".jpg"):
-		return jpeg.Encode(f, m, nil)
+		return jpeg.Encode(w, m, nil)
 	case strings.HasSuffix(ext, ".png"):
-		return png.Encode(f, m)
+		return png.Encode(w, m)
+	case strings.HasSuffix(ext, ".memp"):
+		return EncodeMemP(w, m)
 	}
 
 	return fmt.Errorf("image: Save, unknown format: %s", filename)
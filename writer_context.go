@@ -0,0 +1,71 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"os"
+)
+
+// contextWriter fails the next Write once ctx is done,
+// so a long encode stops between two writes.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (p *contextWriter) Write(b []byte) (n int, err error) {
+	if err = p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return p.w.Write(b)
+}
+
+// EncodeContext is like Encode, but stops when ctx is done.
+func EncodeContext(ctx context.Context, m image.Image, encoder Encoder) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if encoder == nil {
+		encoder = png.Encode
+	}
+	b := bytes.NewBuffer([]byte{})
+	if err := encoder(&contextWriter{ctx, b}, m); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// SaveContext is like Save, but stops when ctx is done.
+// The partial file is removed if the save fails.
+func SaveContext(ctx context.Context, filename string, m image.Image, encoder Encoder) (err error) {
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			os.Remove(filename)
+		}
+	}()
+
+	if err = encodeFile(&contextWriter{ctx, f}, filename, m, encoder); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"context"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := image.NewGray(image.Rect(0, 0, 16, 8))
+	filename := filepath.Join(dir, "a.png")
+	if err := SaveContext(context.Background(), filename, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _, err := LoadConfig(filename); err != nil || cfg.Width != 16 || cfg.Height != 8 {
+		t.Fatalf("bad config: %v, %v", cfg, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	filename = filepath.Join(dir, "b.png")
+	if err := SaveContext(ctx, filename, m, nil); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	if _, err := EncodeContext(ctx, m, nil); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+
+	// cancelled during the encode, the partial file is removed
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	encoder := func(w io.Writer, m image.Image) error {
+		if _, err := w.Write([]byte("head")); err != nil {
+			return err
+		}
+		cancel()
+		_, err := w.Write([]byte("body"))
+		return err
+	}
+	if err := SaveContext(ctx, filename, m, encoder); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("expect no partial file, got %v", err)
+	}
+}